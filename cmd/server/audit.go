@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/MiladJlz/dekamond-task/internal/config"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"go.uber.org/zap"
+)
+
+const auditUsage = `usage: server audit <command>
+
+commands:
+  verify  recompute the audit log hash chain and report the first tampered entry`
+
+// runAudit implements the audit subcommand
+func runAudit(args []string, sugar *zap.SugaredLogger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing audit command\n%s", auditUsage)
+	}
+	if args[0] != "verify" {
+		return fmt.Errorf("unknown audit command %q\n%s", args[0], auditUsage)
+	}
+
+	store, err := db.NewPostgresDB(config.LoadPostgresDSN(sugar.Desugar()))
+	if err != nil {
+		return fmt.Errorf("connect to postgres: %w", err)
+	}
+	defer store.DB.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	count, head, err := store.VerifyAuditLog(ctx)
+	var chainErr *db.AuditChainError
+	if errors.As(err, &chainErr) {
+		sugar.Errorw("audit log tampered", "entry_id", chainErr.ID, "reason", chainErr.Reason, "verified_entries", count)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Record the head hash elsewhere: entries removed from the end are only noticed against it
+	sugar.Infow("audit log verified", "entries", count, "head_hash", head)
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/MiladJlz/dekamond-task/internal/config"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/MiladJlz/dekamond-task/internal/userimport"
+	"go.uber.org/zap"
+)
+
+const importUsage = `usage: server import [flags] <file>
+
+Create users from a CSV or NDJSON file, or standard input when file is -. The outcome of every
+row is written to standard output as NDJSON.
+
+flags:`
+
+// runImport implements the import subcommand
+func runImport(args []string, sugar *zap.SugaredLogger) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), importUsage)
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "", "csv or ndjson (default: from the file extension, else csv)")
+	countryCode := flags.String("country-code", "", "calling code given to phone numbers without one, e.g. 98 (default: PHONE_COUNTRY_CODE)")
+	batchSize := flags.Int("batch-size", userimport.DefaultBatchSize, "rows loaded per COPY")
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one file")
+	}
+	path := flags.Arg(0)
+
+	opts := userimport.Options{
+		Format:             *format,
+		DefaultCountryCode: strings.TrimPrefix(*countryCode, "+"),
+		BatchSize:          *batchSize,
+	}
+	if opts.DefaultCountryCode == "" {
+		opts.DefaultCountryCode = config.LoadPhoneCountryCode(sugar.Desugar())
+	}
+	if opts.Format == "" {
+		opts.Format = "csv"
+		if strings.HasSuffix(path, ".ndjson") || strings.HasSuffix(path, ".jsonl") {
+			opts.Format = "ndjson"
+		}
+	}
+
+	var src io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		src = f
+	}
+
+	store, err := db.NewPostgresDB(config.LoadPostgresDSN(sugar.Desugar()))
+	if err != nil {
+		return fmt.Errorf("connect to postgres: %w", err)
+	}
+	defer store.DB.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+
+	summary, err := userimport.Import(ctx, store, src, opts, func(result userimport.Result) error {
+		return enc.Encode(result)
+	})
+	sugar.Infow("user import finished", "created", summary.Created, "skipped", summary.Skipped, "invalid", summary.Invalid)
+
+	if summary.Created > 0 || err == nil {
+		details, _ := json.Marshal(map[string]any{
+			"format": opts.Format, "file": path, "created": summary.Created, "skipped": summary.Skipped, "invalid": summary.Invalid,
+		})
+		if auditErr := store.AppendAuditEntry(&types.AuditEntry{Action: types.AuditUsersImported, Details: details}); auditErr != nil {
+			sugar.Errorw("append audit entry failed", "error", auditErr, "action", types.AuditUsersImported)
+		}
+	}
+	return err
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os"
 
 	_ "github.com/MiladJlz/dekamond-task/docs"
 	"github.com/MiladJlz/dekamond-task/internal/api"
 	_ "github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
 	"github.com/MiladJlz/dekamond-task/internal/config"
 	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/db/memory"
+	"github.com/MiladJlz/dekamond-task/internal/jobs"
 	"github.com/MiladJlz/dekamond-task/internal/otp"
+	"github.com/MiladJlz/dekamond-task/internal/totp"
 	_ "github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/MiladJlz/dekamond-task/internal/webauthn"
 	"github.com/go-chi/chi/v5"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 	"go.uber.org/zap"
@@ -32,6 +39,11 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
 
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key for service-to-service access.
+
 // @host localhost:8080
 // @BasePath /v1
 func main() {
@@ -42,22 +54,131 @@ func main() {
 	defer logger.Sync()
 	sugar := logger.Sugar()
 
-	cfg := config.LoadConfig(logger)
-
-	db, err := db.NewPostgresDB(cfg.PostgresDSN)
-	if err != nil {
-		sugar.Fatalw("cannot connect to postgres", "error", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:], sugar); err != nil {
+			sugar.Fatalw("migrate failed", "error", err)
+		}
+		return
 	}
-	if pingErr := db.DB.Ping(); pingErr != nil {
-		sugar.Fatalw("postgres ping failed", "error", pingErr)
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := runAudit(os.Args[2:], sugar); err != nil {
+			sugar.Fatalw("audit failed", "error", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:], sugar); err != nil {
+			sugar.Fatalw("import failed", "error", err)
+		}
+		return
 	}
+	if len(os.Args) > 1 && os.Args[1] == "phones" {
+		if err := runPhones(os.Args[2:], sugar); err != nil {
+			sugar.Fatalw("phones failed", "error", err)
+		}
+		return
+	}
+
+	cfg := config.LoadConfig(logger)
+
+	store := openStore(cfg, sugar)
 
 	redisClient := otp.NewRedisClient(cfg.RedisAddr, cfg.OTPTTL, cfg.RateLimit, cfg.RateLimitWindow)
 	if err := redisClient.PingRedis(); err != nil {
 		sugar.Fatalw("redis not reachable", "error", err)
 	}
 
-	h := api.NewHandler(db, redisClient, cfg.JWTSecret, sugar)
+	tokens := auth.TokenConfig{
+		Secret:           cfg.JWTSecret,
+		Issuer:           cfg.JWTIssuer,
+		Audiences:        cfg.JWTAudiences,
+		ClientAudiences:  cfg.JWTClientAudiences,
+		TTL:              cfg.JWTTTL,
+		ImpersonationTTL: cfg.ImpersonationTTL,
+		Leeway:           cfg.JWTLeeway,
+	}
+
+	var signingKey *auth.SigningKey
+	if cfg.OIDCSigningKeyFile != "" {
+		if signingKey, err = auth.LoadSigningKey(cfg.OIDCSigningKeyFile); err != nil {
+			sugar.Fatalw("cannot load oidc signing key", "error", err, "path", cfg.OIDCSigningKeyFile)
+		}
+	} else {
+		if signingKey, err = auth.GenerateSigningKey(); err != nil {
+			sugar.Fatalw("cannot generate oidc signing key", "error", err)
+		}
+		sugar.Warnw("OIDC_SIGNING_KEY_FILE not set; using an ephemeral key, issued ID tokens will not verify after restart")
+	}
+
+	oidc := api.OIDCConfig{
+		IssuerURL:  cfg.OIDCIssuerURL,
+		SigningKey: signingKey,
+		CodeTTL:    cfg.OIDCCodeTTL,
+		LoginTTL:   cfg.OIDCLoginTTL,
+	}
+
+	totpCipher, err := totp.NewCipher(cfg.TOTPEncryptionKey)
+	if err != nil {
+		sugar.Fatalw("cannot init totp cipher", "error", err)
+	}
+
+	mfa := api.MFAConfig{
+		Cipher:       totpCipher,
+		Issuer:       cfg.TOTPIssuer,
+		ChallengeTTL: cfg.MFAChallengeTTL,
+	}
+
+	passkeys := api.PasskeyConfig{
+		RelyingParty: &webauthn.RelyingParty{
+			ID:      cfg.WebAuthnRPID,
+			Name:    cfg.WebAuthnRPName,
+			Origins: cfg.WebAuthnOrigins,
+		},
+		ChallengeTTL: cfg.WebAuthnChallengeTTL,
+	}
+
+	cookies := api.CookieConfig{
+		Clients:  cfg.SessionCookieClients,
+		Domain:   cfg.SessionCookieDomain,
+		Secure:   cfg.SessionCookieSecure,
+		SameSite: cfg.SessionCookieSameSite,
+	}
+	if cookies.SameSite == http.SameSiteNoneMode && !cookies.Secure {
+		sugar.Fatalw("SESSION_COOKIE_SAMESITE=none requires SESSION_COOKIE_SECURE=true")
+	}
+
+	accounts := api.AccountConfig{
+		DeletionGracePeriod: cfg.AccountDeletionGracePeriod,
+		PhoneCountryCode:    cfg.PhoneCountryCode,
+		AuditPhoneKey:       cfg.AuditPhoneKey,
+	}
+
+	exports := api.ExportConfig{
+		Dir:        cfg.ExportDir,
+		Retention:  cfg.ExportRetention,
+		MaxRunning: cfg.ExportMaxRunning,
+	}
+	// Exports of the previous run can no longer be downloaded, but hold a copy of the users
+	if removed, err := api.SweepExportDir(exports); err != nil {
+		sugar.Errorw("sweep export dir failed", "error", err, "dir", exports.Dir)
+	} else if removed > 0 {
+		sugar.Infow("removed stale user exports", "files", removed, "dir", exports.Dir)
+	}
+
+	imports := api.ImportConfig{
+		MaxBytes:  int64(cfg.ImportMaxBytes),
+		BatchSize: cfg.ImportBatchSize,
+	}
+
+	h := api.NewHandler(store, redisClient, tokens, oidc, mfa, passkeys, cookies, accounts, exports, imports, sugar)
+
+	accountDeletion := &jobs.AccountDeletion{
+		Store:     store,
+		Anonymize: cfg.AccountDeletionAnonymize,
+		Interval:  cfg.AccountPurgeInterval,
+		Logger:    sugar,
+	}
+	go accountDeletion.Run(context.Background())
 
 	r := chi.NewRouter()
 
@@ -70,10 +191,65 @@ func main() {
 	// Auth routes
 	v1.Post("/request-otp", h.RequestOTP)
 	v1.Post("/verify-otp", h.VerifyOTP)
+	v1.Post("/verify-otp/totp", h.VerifyTOTP)
+	v1.Post("/passkeys/login/options", h.BeginPasskeyLogin)
+	v1.Post("/passkeys/login", h.FinishPasskeyLogin)
+	v1.HandleFunc("/auth/forward", h.JWTAuthMiddleware(h.ForwardAuth))
 
-	// User management routes (protected with JWT)
-	v1.Get("/users", h.JWTAuthMiddleware(h.GetUsers))
-	v1.Get("/users/{id}", h.JWTAuthMiddleware(h.GetUser))
+	// OpenID Connect provider routes
+	v1.Get("/.well-known/openid-configuration", h.OpenIDConfiguration)
+	v1.Get("/jwks.json", h.JWKS)
+	v1.Get("/authorize", h.Authorize)
+	v1.Post("/authorize/otp", h.AuthorizeRequestOTP)
+	v1.Post("/authorize/verify", h.AuthorizeVerifyOTP)
+	v1.Post("/authorize/totp", h.AuthorizeVerifyTOTP)
+	v1.Post("/token", h.Token)
+	v1.Post("/introspect", h.Introspect)
+	v1.Post("/revoke", h.Revoke)
+	v1.Get("/userinfo", h.JWTAuthMiddleware(h.UserInfo))
+	v1.Post("/clients", h.JWTAuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionClientsWrite, h.RegisterClient))))
+
+	// Current user routes (protected with JWT)
+	v1.Get("/me", h.JWTAuthMiddleware(h.GetMe))
+	v1.Patch("/me", h.JWTAuthMiddleware(h.RejectImpersonation(h.UpdateMe)))
+	v1.Delete("/me", h.JWTAuthMiddleware(h.RejectImpersonation(h.DeleteMe)))
+	v1.Post("/me/logout", h.JWTAuthMiddleware(h.Logout))
+	v1.Get("/me/sessions", h.JWTAuthMiddleware(h.ListSessions))
+	v1.Get("/me/logins", h.JWTAuthMiddleware(h.ListMyLogins))
+	v1.Delete("/me/sessions/{id}", h.JWTAuthMiddleware(h.RejectImpersonation(h.RevokeSession)))
+	v1.Post("/me/step-up/request-otp", h.JWTAuthMiddleware(h.RejectImpersonation(h.StepUpRequestOTP)))
+	v1.Post("/me/step-up", h.JWTAuthMiddleware(h.RejectImpersonation(h.StepUpVerify)))
+	v1.Post("/me/totp", h.JWTAuthMiddleware(h.RequireRecentAuth(cfg.StepUpMaxAge, h.EnrollTOTP)))
+	v1.Post("/me/totp/confirm", h.JWTAuthMiddleware(h.RejectImpersonation(h.ConfirmTOTP)))
+	v1.Delete("/me/totp", h.JWTAuthMiddleware(h.RequireRecentAuth(cfg.StepUpMaxAge, h.DisableTOTP)))
+	v1.Get("/me/passkeys", h.JWTAuthMiddleware(h.ListPasskeys))
+	v1.Post("/me/passkeys/register/options", h.JWTAuthMiddleware(h.RequireRecentAuth(cfg.StepUpMaxAge, h.BeginPasskeyRegistration)))
+	v1.Post("/me/passkeys/register", h.JWTAuthMiddleware(h.RejectImpersonation(h.FinishPasskeyRegistration)))
+	v1.Delete("/me/passkeys/{id}", h.JWTAuthMiddleware(h.RequireRecentAuth(cfg.StepUpMaxAge, h.DeletePasskey)))
+
+	// User management routes (protected with JWT or API key, and permissions)
+	v1.Get("/users", h.AuthMiddleware(h.RequirePermission(auth.PermissionUsersList, h.GetUsers)))
+	v1.Get("/users/export", h.AuthMiddleware(h.RequirePermission(auth.PermissionUsersExport, h.ExportUsers)))
+	v1.Post("/users/exports", h.AuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionUsersExport, h.StartUserExport))))
+	v1.Get("/users/exports/{id}", h.AuthMiddleware(h.RequirePermission(auth.PermissionUsersExport, h.GetUserExport)))
+	v1.Get("/users/exports/{id}/download", h.AuthMiddleware(h.RequirePermission(auth.PermissionUsersExport, h.DownloadUserExport)))
+	v1.Delete("/users/exports/{id}", h.AuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionUsersExport, h.CancelUserExport))))
+	v1.Post("/users/import", h.AuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionUsersImport, h.ImportUsers))))
+	v1.Get("/users/{id}", h.AuthMiddleware(h.GetUser))
+	v1.Put("/users/{id}/roles/{role}", h.AuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionRolesWrite, h.AssignUserRole))))
+	v1.Delete("/users/{id}/roles/{role}", h.AuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionRolesWrite, h.RemoveUserRole))))
+	v1.Get("/users/{id}/logins", h.AuthMiddleware(h.RequirePermission(auth.PermissionUsersRead, h.ListUserLogins)))
+	v1.Post("/users/{id}/block", h.AuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionUsersBlock, h.BlockUser))))
+	v1.Post("/users/{id}/unblock", h.AuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionUsersBlock, h.UnblockUser))))
+	v1.Post("/users/{id}/impersonate", h.JWTAuthMiddleware(h.RequirePermission(auth.PermissionUsersImpersonate, h.RequireRecentAuth(cfg.StepUpMaxAge, h.ImpersonateUser))))
+
+	// API key management (protected with JWT; keys are managed by people, not by other keys)
+	v1.Post("/api-keys", h.JWTAuthMiddleware(h.RequirePermission(auth.PermissionAPIKeysWrite, h.RequireRecentAuth(cfg.StepUpMaxAge, h.CreateAPIKey))))
+	v1.Get("/api-keys", h.JWTAuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionAPIKeysWrite, h.ListAPIKeys))))
+	v1.Delete("/api-keys/{id}", h.JWTAuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionAPIKeysWrite, h.RevokeAPIKey))))
+
+	// Audit log (protected with JWT or API key, and permissions)
+	v1.Get("/audit-log", h.AuthMiddleware(h.RequirePermission(auth.PermissionAuditRead, h.ListAuditLog)))
 
 	// Swagger documentation (versioned)
 	v1.Get("/swagger/*", httpSwagger.Handler(
@@ -87,5 +263,59 @@ func main() {
 		"otp_ttl", cfg.OTPTTL.String(),
 		"rate_limit", cfg.RateLimit,
 		"rate_limit_window", cfg.RateLimitWindow.String())
+	sugar.Infow("jwt configuration",
+		"issuer", cfg.JWTIssuer,
+		"audiences", cfg.JWTAudiences,
+		"ttl", cfg.JWTTTL.String(),
+		"leeway", cfg.JWTLeeway.String())
 	sugar.Fatalw("server failed", "error", http.ListenAndServe(":"+cfg.AppPort, r))
 }
+
+// openStore connects to the configured storage, applying migrations to Postgres if enabled and
+// starting health checks of its read replicas
+func openStore(cfg *config.Config, sugar *zap.SugaredLogger) db.UserRepository {
+	if cfg.DatabaseDriver == "memory" {
+		sugar.Warnw("DATABASE_DRIVER=memory; data is kept in process memory and lost on restart")
+		return memory.New()
+	}
+
+	store, err := db.NewPostgresDB(cfg.PostgresDSN)
+	if err != nil {
+		sugar.Fatalw("cannot connect to postgres", "error", err)
+	}
+	if pingErr := store.DB.Ping(); pingErr != nil {
+		sugar.Fatalw("postgres ping failed", "error", pingErr)
+	}
+
+	if cfg.MigrateOnStartup {
+		if err := applyMigrations(store, sugar); err != nil {
+			sugar.Fatalw("cannot apply migrations", "error", err)
+		}
+	}
+
+	// Logins look users up by their E.164 number; users still stored as typed would silently get
+	// a second account, so their numbers must be rewritten first
+	legacy, err := store.CountLegacyPhones()
+	if err != nil {
+		sugar.Fatalw("cannot check for legacy phone numbers", "error", err)
+	}
+	if legacy > 0 {
+		sugar.Fatalw("users have phone numbers that are not in E.164 form; run `server phones normalize` and resolve its conflicts before starting",
+			"users", legacy)
+	}
+
+	if len(cfg.PostgresReplicaDSNs) > 0 {
+		for _, dsn := range cfg.PostgresReplicaDSNs {
+			if err := store.AddReplica(dsn, cfg.ReplicaMaxLag); err != nil {
+				sugar.Fatalw("cannot open read replica", "error", err)
+			}
+		}
+		replicaHealth := &jobs.ReplicaHealth{
+			Store:    store,
+			Interval: cfg.ReplicaHealthInterval,
+			Logger:   sugar,
+		}
+		go replicaHealth.Run(context.Background())
+	}
+	return store
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/config"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/migrate"
+	migrations "github.com/MiladJlz/dekamond-task/migirations"
+	"go.uber.org/zap"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up                  apply all pending migrations
+  down [steps]        revert the last applied migrations (default 1)
+  status              list migrations and when they were applied
+  baseline <version>  mark migrations up to version as applied without running them`
+
+// runMigrate implements the migrate subcommand
+func runMigrate(args []string, sugar *zap.SugaredLogger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+
+	store, err := db.NewPostgresDB(config.LoadPostgresDSN(sugar.Desugar()))
+	if err != nil {
+		return fmt.Errorf("connect to postgres: %w", err)
+	}
+	defer store.DB.Close()
+
+	migrator, err := migrate.New(store.DB, migrations.FS)
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		logMigrations(sugar, "migration applied", applied)
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		logMigrations(sugar, "migration reverted", reverted)
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return tw.Flush()
+
+	case "baseline":
+		if len(args) < 2 {
+			return fmt.Errorf("missing baseline version\n%s", migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := migrator.Baseline(ctx, version); err != nil {
+			return err
+		}
+		sugar.Infow("migrations baselined", "version", version)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+}
+
+// applyMigrations brings the schema up to date before the server starts
+func applyMigrations(store *db.Store, sugar *zap.SugaredLogger) error {
+	migrator, err := migrate.New(store.DB, migrations.FS)
+	if err != nil {
+		return fmt.Errorf("load migrations: %w", err)
+	}
+
+	applied, err := migrator.Up(context.Background())
+	logMigrations(sugar, "migration applied", applied)
+	return err
+}
+
+func logMigrations(sugar *zap.SugaredLogger, msg string, list []migrate.Migration) {
+	for _, migration := range list {
+		sugar.Infow(msg, "version", migration.Version, "name", migration.Name)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/MiladJlz/dekamond-task/internal/config"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"go.uber.org/zap"
+)
+
+const phonesUsage = `usage: server phones normalize [flags]
+
+Rewrite phone numbers stored before logins normalized them to E.164, so they match at login and
+in the country_code filter. The outcome for every such user is written to standard output as
+NDJSON. Numbers another user already has in E.164 form are left for manual review. The server
+does not start while any such number is left.
+
+flags:`
+
+// phoneChange is the outcome of normalizing one stored phone number
+type phoneChange struct {
+	UserID     uint64 `json:"user_id"`
+	Phone      string `json:"phone"`
+	Normalized string `json:"normalized,omitempty"`
+	// Status is updated, would_update (with -dry-run), conflict or invalid
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// runPhones implements the phones subcommand
+func runPhones(args []string, sugar *zap.SugaredLogger) error {
+	if len(args) == 0 || args[0] != "normalize" {
+		fmt.Fprintln(os.Stderr, phonesUsage)
+		return fmt.Errorf("expected the normalize command")
+	}
+
+	flags := flag.NewFlagSet("phones normalize", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), phonesUsage)
+		flags.PrintDefaults()
+	}
+	countryCode := flags.String("country-code", "", "calling code given to phone numbers without one, e.g. 98 (default: PHONE_COUNTRY_CODE)")
+	dryRun := flags.Bool("dry-run", false, "report the changes without making them")
+	if err := flags.Parse(args[1:]); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	code := strings.TrimPrefix(*countryCode, "+")
+	if code == "" {
+		code = config.LoadPhoneCountryCode(sugar.Desugar())
+	}
+
+	store, err := db.NewPostgresDB(config.LoadPostgresDSN(sugar.Desugar()))
+	if err != nil {
+		return fmt.Errorf("connect to postgres: %w", err)
+	}
+	defer store.DB.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	phones, err := store.GetLegacyPhones(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+
+	counts := map[string]int{}
+	for _, p := range phones {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		change := phoneChange{UserID: p.UserID, Phone: p.Phone}
+		if change.Normalized, err = types.NormalizePhone(p.Phone, code); err != nil {
+			change.Status, change.Reason = "invalid", err.Error()
+		} else if *dryRun {
+			change.Status = "would_update"
+		} else {
+			switch err := store.UpdateUserPhone(p.UserID, change.Normalized); {
+			case err == nil:
+				change.Status = "updated"
+			case errors.Is(err, db.ErrConflict):
+				change.Status, change.Reason = "conflict", "another user has this phone"
+			case errors.Is(err, db.ErrNotFound):
+				continue
+			default:
+				return err
+			}
+		}
+		counts[change.Status]++
+		if err := enc.Encode(change); err != nil {
+			return err
+		}
+	}
+	sugar.Infow("phone normalization finished", "legacy", len(phones), "updated", counts["updated"], "would_update", counts["would_update"],
+		"conflict", counts["conflict"], "invalid", counts["invalid"])
+
+	if counts["updated"] > 0 {
+		details, _ := json.Marshal(map[string]any{"updated": counts["updated"], "conflict": counts["conflict"], "invalid": counts["invalid"]})
+		if err := store.AppendAuditEntry(&types.AuditEntry{Action: types.AuditPhonesNormalized, Details: details}); err != nil {
+			sugar.Errorw("append audit entry failed", "error", err, "action", types.AuditPhonesNormalized)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/otp"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// AccountConfig configures account lifecycle operations
+type AccountConfig struct {
+	// DeletionGracePeriod is how long a deleted account can still be restored by logging in
+	DeletionGracePeriod time.Duration
+	// PhoneCountryCode is given to phone numbers entered without a calling code, digits only;
+	// when empty such numbers are rejected
+	PhoneCountryCode string
+	// AuditPhoneKey keys the hashes that stand in for unknown phone numbers in the audit log;
+	// when nil no hash is recorded
+	AuditPhoneKey []byte
+}
+
+// DeleteMe godoc
+// @Summary Delete current user
+// @Description Schedule the current account for deletion, confirmed with a fresh OTP from /me/step-up/request-otp. All sessions are revoked; logging in again before deletion_scheduled_at cancels the deletion, afterwards the account and its data are purged.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body dto.DeleteAccountRequest true "OTP confirming the deletion"
+// @Success 202 {object} dto.AccountDeletionResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
+// @Router /me [delete]
+func (h *Handler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	var req dto.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+	if req.Code == "" {
+		JSONError(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := h.otp.Validate(otp.PurposeStepUp, principal.Phone, req.Code)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "validate deletion otp error", "user_id", principal.UserID)
+		return
+	}
+	if !valid {
+		JSONError(w, "Invalid OTP", http.StatusUnauthorized)
+		return
+	}
+
+	deleteAt := time.Now().Add(h.accounts.DeletionGracePeriod)
+	if err := h.store.ScheduleUserDeletion(principal.UserID, deleteAt); err != nil {
+		h.JSONErrorWithLog(w, "Failed to delete account", http.StatusInternalServerError, err, "schedule user deletion failed", "user_id", principal.UserID)
+		return
+	}
+
+	h.clearSessionCookies(w)
+	h.logger.Infow("account deletion scheduled", "user_id", principal.UserID, "delete_at", deleteAt)
+	h.audit(r, types.AuditDeletionScheduled, principal.UserID, map[string]any{"delete_at": deleteAt})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(dto.AccountDeletionResponse{
+		Message:             "Account scheduled for deletion",
+		DeletionScheduledAt: deleteAt,
+	})
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/otp"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	apiKeyPrefixMarker = "dk_"
+	// apiKeyPrefixLength is how much of the key is stored in clear text to identify it
+	apiKeyPrefixLength = len(apiKeyPrefixMarker) + 8
+)
+
+// CreateAPIKey godoc
+// @Summary Create API key
+// @Description Create a scoped API key for service-to-service access (requires api_keys:write). The caller can only grant permissions they hold and must have authenticated recently (see /me/step-up).
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body dto.CreateAPIKeyRequest true "API key definition"
+// @Success 201 {object} dto.CreateAPIKeyResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api-keys [post]
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	var req dto.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Scopes) == 0 {
+		JSONError(w, "Name and scopes are required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !principal.HasScope(scope) {
+			JSONError(w, "Cannot grant a permission you do not hold: "+scope, http.StatusForbidden)
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		JSONError(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := otp.RandomToken(32)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to create API key", http.StatusInternalServerError, err, "generate api key failed")
+		return
+	}
+	rawKey := apiKeyPrefixMarker + secret
+
+	key := &types.APIKey{
+		Name:      req.Name,
+		Prefix:    apiKeyPrefix(rawKey),
+		KeyHash:   auth.HashSecret(rawKey),
+		Scopes:    req.Scopes,
+		CreatedBy: principal.UserID,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.store.CreateAPIKey(key); err != nil {
+		h.JSONErrorWithLog(w, "Failed to create API key", http.StatusInternalServerError, err, "create api key failed", "name", req.Name)
+		return
+	}
+
+	h.logger.Infow("api key created", "api_key_id", key.ID, "scopes", key.Scopes, "by_user_id", principal.UserID)
+	h.audit(r, types.AuditAPIKeyCreated, 0, map[string]any{"api_key_id": key.ID, "name": key.Name, "scopes": key.Scopes})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(dto.CreateAPIKeyResponse{APIKey: *key, Key: rawKey})
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List all API keys with their last use (requires api_keys:write)
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.APIKeyListResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api-keys [get]
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.store.ListAPIKeys()
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to fetch API keys", http.StatusInternalServerError, err, "list api keys failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(dto.APIKeyListResponse{APIKeys: keys})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke API key
+// @Description Revoke an API key immediately (requires api_keys:write)
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 204 {string} string "API key revoked"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api-keys/{id} [delete]
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := h.store.RevokeAPIKey(id)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to revoke API key", http.StatusInternalServerError, err, "revoke api key failed", "api_key_id", id)
+		return
+	}
+	if !revoked {
+		JSONError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	h.logger.Infow("api key revoked", "api_key_id", id, "by_user_id", principal.UserID)
+	h.audit(r, types.AuditAPIKeyRevoked, 0, map[string]any{"api_key_id": id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiKeyPrefix returns the non-secret leading part of a key used to identify it in listings and logs
+func apiKeyPrefix(rawKey string) string {
+	if len(rawKey) <= apiKeyPrefixLength {
+		return rawKey
+	}
+	return rawKey[:apiKeyPrefixLength]
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// audit appends action on targetUserID to the audit log, attributed to the principal of request r
+// if there is one. details holds action specific fields and may be nil. Failures do not fail the
+// request; they are logged and reported by /health.
+func (h *Handler) audit(r *http.Request, action string, targetUserID uint64, details map[string]any) {
+	entry := &types.AuditEntry{Action: action, TargetUserID: targetUserID, IPAddress: clientIP(r)}
+	if principal, ok := GetPrincipalFromContext(r); ok {
+		entry.ActorUserID = principal.UserID
+		entry.ActorAPIKeyID = principal.APIKeyID
+		// Impersonated requests are done by the staff member, on behalf of the user
+		if principal.ActorID != 0 {
+			entry.ActorUserID = principal.ActorID
+		}
+	}
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			h.logger.Errorw("encode audit details failed", "error", err, "action", action)
+			return
+		}
+		entry.Details = raw
+	}
+
+	err := h.store.AppendAuditEntry(entry)
+	if failures := h.auditLog.record(err); err != nil {
+		h.logger.Errorw("append audit entry failed", "error", err, "action", action, "target_user_id", targetUserID, "failures", failures)
+	}
+}
+
+// auditLogStatus counts failed audit appends, so a log that silently stops growing shows up in
+// health checks
+type auditLogStatus struct {
+	mu            sync.Mutex
+	failing       bool
+	failures      uint64
+	lastError     string
+	lastFailureAt time.Time
+}
+
+// record notes the outcome of an append and returns the number of failures so far
+func (s *auditLogStatus) record(err error) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failing = err != nil
+	if err != nil {
+		s.failures++
+		s.lastError = err.Error()
+		s.lastFailureAt = time.Now()
+	}
+	return s.failures
+}
+
+func (s *auditLogStatus) health() dto.AuditLogHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health := dto.AuditLogHealth{Status: "up", Failures: s.failures, LastError: s.lastError}
+	if s.failing {
+		health.Status = "failing"
+	}
+	if s.failures > 0 {
+		lastFailureAt := s.lastFailureAt
+		health.LastFailureAt = &lastFailureAt
+	}
+	return health
+}
+
+// withPhoneHash identifies a phone number that belongs to no known user in audit details. The
+// log cannot be changed when a user is purged, so it never holds the number itself: the keyed
+// hash lets an investigator match a number they already have, without revealing it. Without
+// AUDIT_PHONE_KEY the number is not recorded at all.
+func (h *Handler) withPhoneHash(details map[string]any, phone string) map[string]any {
+	if h.accounts.AuditPhoneKey == nil {
+		return details
+	}
+	mac := hmac.New(sha256.New, h.accounts.AuditPhoneKey)
+	mac.Write([]byte(phone))
+	if details == nil {
+		details = map[string]any{}
+	}
+	details["phone_hash"] = hex.EncodeToString(mac.Sum(nil))
+	return details
+}
+
+// ListAuditLog godoc
+// @Summary Query the audit log
+// @Description List audit log entries, newest first (requires audit:read). Each entry carries the hash chaining it to the previous one; run "server audit verify" to check the whole chain.
+// @Tags audit
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param action query string false "Action, e.g. role.granted"
+// @Param actor_id query int false "User who performed the action"
+// @Param target_id query int false "User the action concerns"
+// @Param from query string false "At or after (RFC 3339)"
+// @Param to query string false "Before (RFC 3339)"
+// @Param limit query int false "Number of entries (default: 20, max: 100)"
+// @Param before query int false "Only entries older than this entry ID, from next_before"
+// @Success 200 {object} dto.AuditLogResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /audit-log [get]
+func (h *Handler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := db.AuditFilter{Action: q.Get("action")}
+	var err error
+	if filter.ActorUserID, err = parseIDParam(q.Get("actor_id")); err != nil {
+		JSONError(w, "Invalid actor_id", http.StatusBadRequest)
+		return
+	}
+	if filter.TargetUserID, err = parseIDParam(q.Get("target_id")); err != nil {
+		JSONError(w, "Invalid target_id", http.StatusBadRequest)
+		return
+	}
+	if filter.From, err = parseTimeParam(q, "from"); err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseTimeParam(q, "to"); err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, before, err := parseIDPage(r)
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.store.ListAuditEntries(filter, limit, before)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to fetch audit log", http.StatusInternalServerError, err, "list audit entries failed", "filter", filter)
+		return
+	}
+
+	resp := dto.AuditLogResponse{Entries: entries}
+	if len(entries) == limit {
+		resp.NextBefore = entries[len(entries)-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// parseIDParam parses an optional ID query parameter; empty means 0
+func parseIDParam(v string) (uint64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/MiladJlz/dekamond-task/internal/otp"
+)
+
+// CookieConfig configures cookie-based browser sessions
+type CookieConfig struct {
+	// Clients lists the client IDs whose logins set cookies instead of returning the token in the body
+	Clients  []string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+const (
+	// AccessTokenCookie carries the JWT for browser clients; it is HttpOnly so scripts cannot read it
+	AccessTokenCookie = "access_token"
+	// CSRFCookie carries the double-submit CSRF token, readable by the frontend
+	CSRFCookie = "csrf_token"
+	// CSRFHeader must echo the CSRF cookie on state-changing requests authenticated by cookie
+	CSRFHeader = "X-CSRF-Token"
+)
+
+type cookieAuthContextKey struct{}
+
+// enabledFor reports whether logins for clientID are delivered as cookies
+func (c CookieConfig) enabledFor(clientID string) bool {
+	return clientID != "" && slices.Contains(c.Clients, clientID)
+}
+
+// setSessionCookies stores token in an HttpOnly cookie with a CSRF cookie bound to the session,
+// and returns the CSRF token
+func (h *Handler) setSessionCookies(w http.ResponseWriter, token string, sessionID uint64) (string, error) {
+	csrf, err := h.newCSRFToken(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	maxAge := int(h.tokens.TTL.Seconds())
+	http.SetCookie(w, h.sessionCookie(AccessTokenCookie, token, true, maxAge))
+	http.SetCookie(w, h.sessionCookie(CSRFCookie, csrf, false, maxAge))
+	return csrf, nil
+}
+
+// clearSessionCookies expires the session cookies in the browser
+func (h *Handler) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, h.sessionCookie(AccessTokenCookie, "", true, -1))
+	http.SetCookie(w, h.sessionCookie(CSRFCookie, "", false, -1))
+}
+
+func (h *Handler) sessionCookie(name, value string, httpOnly bool, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   h.cookies.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   h.cookies.Secure,
+		SameSite: h.cookies.SameSite,
+	}
+}
+
+// newCSRFToken returns a random token signed together with the session ID, so a token planted
+// by a sibling subdomain or taken from another session is rejected
+func (h *Handler) newCSRFToken(sessionID uint64) (string, error) {
+	nonce, err := otp.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	return nonce + "." + h.csrfSignature(nonce, sessionID), nil
+}
+
+func (h *Handler) csrfSignature(nonce string, sessionID uint64) string {
+	mac := hmac.New(sha256.New, []byte(h.tokens.Secret))
+	mac.Write([]byte("csrf:" + strconv.FormatUint(sessionID, 10) + ":" + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validCSRFRequest checks the double-submit token of a cookie-authenticated request. Safe methods
+// pass, unless a proxy asking /auth/forward reports that the original request was unsafe.
+func (h *Handler) validCSRFRequest(r *http.Request, sessionID uint64) bool {
+	method := r.Method
+	if forwarded := r.Header.Get("X-Forwarded-Method"); forwarded != "" && safeMethod(method) {
+		method = forwarded
+	}
+	if safeMethod(method) {
+		return true
+	}
+
+	header := r.Header.Get(CSRFHeader)
+	cookie, err := r.Cookie(CSRFCookie)
+	if header == "" || err != nil || !hmac.Equal([]byte(header), []byte(cookie.Value)) {
+		return false
+	}
+
+	nonce, signature, ok := strings.Cut(header, ".")
+	return ok && hmac.Equal([]byte(signature), []byte(h.csrfSignature(nonce, sessionID)))
+}
+
+func safeMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// withCookieAuth marks the request as authenticated by the session cookie
+func withCookieAuth(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cookieAuthContextKey{}, true)
+}
+
+// cookieAuthenticated reports whether the request was authenticated by the session cookie
+// rather than an Authorization header, so reissued tokens go back into the cookie
+func cookieAuthenticated(r *http.Request) bool {
+	ok, _ := r.Context().Value(cookieAuthContextKey{}).(bool)
+	return ok
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revoke the current session and clear the session cookies. Works for cookie and Bearer authentication.
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 204 {string} string "Logged out"
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/logout [post]
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	if principal.SessionID != 0 {
+		if _, err := h.store.RevokeSession(principal.SessionID, principal.UserID); err != nil {
+			h.JSONErrorWithLog(w, "Failed to log out", http.StatusInternalServerError, err, "revoke session failed", "user_id", principal.UserID, "session_id", principal.SessionID)
+			return
+		}
+	}
+
+	h.clearSessionCookies(w)
+	h.logger.Infow("logged out", "user_id", principal.UserID, "session_id", principal.SessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
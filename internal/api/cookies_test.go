@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidCSRFRequest(t *testing.T) {
+	h := newTestServer(t).handler
+	const sessionID = 7
+
+	token, err := h.newCSRFToken(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSession, err := h.newCSRFToken(sessionID + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := h.newCSRFToken(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		forwarded string
+		header    string
+		cookie    string
+		want      bool
+	}{
+		{name: "safe method", method: http.MethodGet, want: true},
+		{name: "matching token", method: http.MethodPost, header: token, cookie: token, want: true},
+		{name: "missing header", method: http.MethodPost, cookie: token},
+		{name: "missing cookie", method: http.MethodPost, header: token},
+		{name: "header and cookie differ", method: http.MethodPost, header: token, cookie: other},
+		{name: "signed for another session", method: http.MethodDelete, header: otherSession, cookie: otherSession},
+		{name: "unsigned token", method: http.MethodPost, header: "nonce", cookie: "nonce"},
+		{name: "forged signature", method: http.MethodPatch, header: "nonce.c2lnbmF0dXJl", cookie: "nonce.c2lnbmF0dXJl"},
+		{name: "forwarded unsafe method without token", method: http.MethodGet, forwarded: http.MethodPost},
+		{name: "forwarded unsafe method in lowercase", method: http.MethodHead, forwarded: "delete"},
+		{name: "forwarded unsafe method with token", method: http.MethodGet, forwarded: http.MethodPost, header: token, cookie: token, want: true},
+		{name: "unsafe method forwarded as safe", method: http.MethodPost, forwarded: http.MethodGet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/me", nil)
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-Method", tt.forwarded)
+			}
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if got := h.validCSRFRequest(r, sessionID); got != tt.want {
+				t.Errorf("validCSRFRequest = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,107 @@
 package dto
 
+import (
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/webauthn"
+)
+
 // RequestOTPRequest is the request body for OTP request.
 // @Description Request body for OTP request
 type RequestOTPRequest struct {
-	Phone string `json:"phone" example:"+1234567890" binding:"required" description:"User's phone number"`
+	Phone string `json:"phone" example:"+1234567890" binding:"required" description:"User's phone number in E.164 form, or a local number when PHONE_COUNTRY_CODE is set"`
 }
 
 // VerifyOTPRequest is the request body for OTP verification.
 // @Description Request body for OTP verification
 type VerifyOTPRequest struct {
-	Phone string `json:"phone" example:"+1234567890" binding:"required" description:"User's phone number"`
-	Code  string `json:"code" example:"123456" binding:"required" description:"6-digit OTP code"`
+	Phone      string `json:"phone" example:"+1234567890" binding:"required" description:"User's phone number in E.164 form, or a local number when PHONE_COUNTRY_CODE is set"`
+	Code       string `json:"code" example:"123456" binding:"required" description:"6-digit OTP code"`
+	ClientID   string `json:"client_id,omitempty" example:"web" description:"Optional client application the token is minted for"`
+	DeviceName string `json:"device_name,omitempty" example:"Pixel 8" description:"Optional device name shown in the session list"`
+}
+
+// RegisterClientRequest is the request body for registering an OIDC client.
+// @Description Request body for OIDC client registration
+type RegisterClientRequest struct {
+	Name         string   `json:"name" example:"Web App" binding:"required" description:"Human readable client name"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required" description:"Absolute redirect URIs allowed for this client"`
+	Audiences    []string `json:"audiences" description:"Audiences minted into access tokens (defaults to the service audience)"`
+	Confidential bool     `json:"confidential" example:"false" description:"Whether the client receives a secret; public clients rely on PKCE only"`
+}
+
+// CreateAPIKeyRequest is the request body for creating an API key.
+// @Description Request body for API key creation
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" example:"nightly-report" binding:"required" description:"Human readable key name"`
+	Scopes    []string   `json:"scopes" binding:"required" description:"Permissions to grant; the caller must hold each of them"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2026-08-19T12:00:00Z" description:"Optional expiration time"`
+}
+
+// StepUpVerifyRequest is the request body for step-up verification.
+// @Description Request body for step-up OTP verification
+type StepUpVerifyRequest struct {
+	Code string `json:"code" example:"123456" binding:"required" description:"6-digit OTP code sent to the current user's phone"`
+}
+
+// TOTPCodeRequest is the request body for confirming an authenticator app.
+// @Description Request body carrying a code from the authenticator app
+type TOTPCodeRequest struct {
+	Code string `json:"code" example:"123456" binding:"required" description:"6-digit code from the authenticator app"`
+}
+
+// VerifyTOTPRequest is the request body for completing a login with an authenticator app.
+// @Description Request body for the second login step
+type VerifyTOTPRequest struct {
+	MFAToken string `json:"mfa_token" example:"pQ4...Zk" binding:"required" description:"Challenge token returned by /verify-otp"`
+	Code     string `json:"code" example:"123456" binding:"required" description:"6-digit code from the authenticator app"`
+}
+
+// RegisterPasskeyRequest is the request body for completing passkey registration.
+// @Description Request body carrying the result of navigator.credentials.create()
+type RegisterPasskeyRequest struct {
+	Name       string                        `json:"name,omitempty" example:"MacBook" description:"Optional name shown in the passkey list"`
+	Credential webauthn.RegistrationResponse `json:"credential" binding:"required" description:"PublicKeyCredential serialized as JSON"`
+}
+
+// PasskeyLoginOptionsRequest is the request body for starting a passkey login.
+// @Description Request body for starting a passkey login
+type PasskeyLoginOptionsRequest struct {
+	ClientID string `json:"client_id,omitempty" example:"web" description:"Optional client application the token is minted for"`
+}
+
+// PasskeyLoginRequest is the request body for completing a passkey login.
+// @Description Request body carrying the result of navigator.credentials.get()
+type PasskeyLoginRequest struct {
+	Credential webauthn.AssertionResponse `json:"credential" binding:"required" description:"PublicKeyCredential serialized as JSON"`
+	DeviceName string                     `json:"device_name,omitempty" example:"Pixel 8" description:"Optional device name shown in the session list"`
+}
+
+// ImpersonateRequest is the request body for impersonating a user.
+// @Description Request body for support impersonation
+type ImpersonateRequest struct {
+	Reason string `json:"reason" example:"Ticket #4821: user cannot see their orders" binding:"required" description:"Justification recorded in the audit log"`
+}
+
+// UpdateProfileRequest is the request body for updating the current user's profile.
+// @Description Request body for a partial profile update; omitted fields are left unchanged and empty strings clear a field
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name,omitempty" example:"Sara Ahmadi" description:"Name shown to other users, at most 100 characters"`
+	Email       *string `json:"email,omitempty" example:"sara@example.com" description:"Contact email address"`
+	Locale      *string `json:"locale,omitempty" example:"fa-IR" description:"Preferred BCP 47 language tag"`
+	AvatarURL   *string `json:"avatar_url,omitempty" example:"https://cdn.example.com/avatars/42.png" description:"HTTPS URL of the profile picture"`
+}
+
+// DeleteAccountRequest is the request body for deleting the current user's account.
+// @Description Request body confirming account deletion with a fresh OTP
+type DeleteAccountRequest struct {
+	Code string `json:"code" example:"123456" binding:"required" description:"6-digit OTP sent by /me/step-up/request-otp"`
+}
+
+// BlockUserRequest is the request body for blocking or suspending a user.
+// @Description Request body for blocking a user indefinitely or suspending them until expires_at
+type BlockUserRequest struct {
+	Status    string     `json:"status,omitempty" example:"suspended" enums:"blocked,suspended" description:"blocked (default) lasts until lifted; suspended requires expires_at"`
+	Reason    string     `json:"reason" example:"Spam reports" binding:"required" description:"Why the user is blocked, shown to staff"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2025-08-26T12:00:00Z" description:"End of a suspension"`
 }
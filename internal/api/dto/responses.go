@@ -1,6 +1,13 @@
 package dto
 
-import "github.com/MiladJlz/dekamond-task/internal/types"
+import (
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/MiladJlz/dekamond-task/internal/userimport"
+	"github.com/MiladJlz/dekamond-task/internal/webauthn"
+)
 
 // RequestOTPResponse is the response for OTP request endpoint
 // @Description Response for OTP request
@@ -12,7 +19,14 @@ type RequestOTPResponse struct {
 // @Description Response for OTP verification
 type VerifyOTPResponse struct {
 	Message string `json:"message" example:"Login success" description:"Success message"`
-	Token   string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..." description:"JWT authentication token"`
+	Token   string `json:"token,omitempty" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..." description:"JWT authentication token"`
+	// IsNewUser is true on the login that registered the user
+	IsNewUser bool `json:"is_new_user" example:"false" description:"Whether this login created the account; route new users to onboarding"`
+	// Set instead of Token when the user must also enter a code from their authenticator app
+	MFARequired bool   `json:"mfa_required,omitempty" example:"false" description:"Whether a TOTP code is required to finish login"`
+	MFAToken    string `json:"mfa_token,omitempty" example:"pQ4...Zk" description:"Challenge token to submit with the TOTP code"`
+	// Set instead of Token for cookie clients; send it back in the X-CSRF-Token header
+	CSRFToken string `json:"csrf_token,omitempty" example:"Zm9v.YmFy" description:"CSRF token for cookie sessions"`
 }
 
 // UserListResponse is the response for user list endpoint
@@ -22,6 +36,8 @@ type UserListResponse struct {
 	Total  int          `json:"total" example:"100" description:"Total number of users"`
 	Offset int          `json:"offset" example:"0" description:"Current offset for pagination"`
 	Limit  int          `json:"limit" example:"10" description:"Number of users per page"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty" example:"MTcyNDA2ODgwMDAwMDAwMDo0Mg" description:"Cursor for the next page; absent on the last page"`
 }
 
 // ComponentHealth describes the health of a single dependency (e.g., Postgres, Redis)
@@ -33,9 +49,31 @@ type ComponentHealth struct {
 // HealthCheckResponse is the response for health check endpoint
 // @Description Response for health check
 type HealthCheckResponse struct {
-	Status   string          `json:"status" example:"healthy" description:"Overall service status"`
+	Status   string          `json:"status" example:"healthy" description:"Overall service status (healthy, or degraded when a read replica is down or audit entries are not being written)"`
 	Postgres ComponentHealth `json:"postgres" description:"PostgreSQL status information"`
 	Redis    ComponentHealth `json:"redis" description:"Redis status information"`
+	AuditLog AuditLogHealth  `json:"audit_log" description:"Audit log writer status information"`
+	// Replicas is absent when no read replicas are configured
+	Replicas []ReplicaHealth `json:"replicas,omitempty" description:"PostgreSQL read replica status information"`
+}
+
+// ReplicaHealth describes the last health check of a read replica
+// @Description Health details for a PostgreSQL read replica
+type ReplicaHealth struct {
+	Name      string    `json:"name" example:"replica-1.internal:5432" description:"Replica host and port"`
+	Status    string    `json:"status" example:"up" description:"Replica status (up/down); a down replica serves no reads"`
+	LagMillis int64     `json:"lag_ms" example:"120" description:"Replication lag in milliseconds at the last check"`
+	Error     string    `json:"error,omitempty" example:"replication lag 45s exceeds 30s" description:"Why the replica is down"`
+	CheckedAt time.Time `json:"checked_at" example:"2024-08-19T12:00:00Z" description:"When the replica was last checked; zero before the first check"`
+}
+
+// AuditLogHealth reports audit entries this instance failed to write since it started
+// @Description Health details for the audit log writer
+type AuditLogHealth struct {
+	Status        string     `json:"status" example:"up" description:"Writer status (up, or failing when the last append failed)"`
+	Failures      uint64     `json:"failures" example:"0" description:"Entries lost to failed appends since the instance started"`
+	LastError     string     `json:"last_error,omitempty" example:"pq: could not serialize access" description:"Why the last failed append failed"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty" example:"2024-08-19T12:00:00Z" description:"When an append last failed"`
 }
 
 // ErrorResponse is the standard error response format
@@ -43,3 +81,180 @@ type HealthCheckResponse struct {
 type ErrorResponse struct {
 	Error string `json:"error" example:"Error message" description:"Error description"`
 }
+
+// OAuthErrorResponse is the RFC 6749 error format used by the OIDC endpoints
+// @Description OAuth 2.0 error response
+type OAuthErrorResponse struct {
+	Error            string `json:"error" example:"invalid_grant" description:"OAuth error code"`
+	ErrorDescription string `json:"error_description,omitempty" example:"authorization code is invalid or expired" description:"Human readable error description"`
+}
+
+// TokenResponse is the response for the OIDC token endpoint
+// @Description OAuth 2.0 token response
+type TokenResponse struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..." description:"JWT access token"`
+	TokenType   string `json:"token_type" example:"Bearer" description:"Token type"`
+	ExpiresIn   int64  `json:"expires_in" example:"86400" description:"Access token lifetime in seconds"`
+	IDToken     string `json:"id_token" example:"eyJhbGciOiJSUzI1NiIsImtpZCI6Ii4uLiJ9..." description:"OpenID Connect ID token"`
+	Scope       string `json:"scope" example:"openid phone" description:"Granted scopes"`
+}
+
+// UserInfoResponse is the response for the OIDC userinfo endpoint
+// @Description OpenID Connect userinfo claims
+type UserInfoResponse struct {
+	Subject             string `json:"sub" example:"1" description:"User ID"`
+	PhoneNumber         string `json:"phone_number,omitempty" example:"+1234567890" description:"Phone number (phone scope)"`
+	PhoneNumberVerified bool   `json:"phone_number_verified,omitempty" example:"true" description:"Whether the phone number was verified (phone scope)"`
+}
+
+// OpenIDConfigurationResponse is the OIDC discovery document
+// @Description OpenID Connect discovery document
+type OpenIDConfigurationResponse struct {
+	Issuer                            string   `json:"issuer" example:"http://localhost:8080/v1"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint" example:"http://localhost:8080/v1/authorize"`
+	TokenEndpoint                     string   `json:"token_endpoint" example:"http://localhost:8080/v1/token"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint" example:"http://localhost:8080/v1/userinfo"`
+	JWKSURI                           string   `json:"jwks_uri" example:"http://localhost:8080/v1/jwks.json"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint" example:"http://localhost:8080/v1/introspect"`
+	RevocationEndpoint                string   `json:"revocation_endpoint" example:"http://localhost:8080/v1/revoke"`
+}
+
+// RegisterClientResponse is the response for OIDC client registration
+// @Description Registered client; the secret is only returned once
+type RegisterClientResponse struct {
+	types.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty" example:"s3cr3t..." description:"Client secret for confidential clients; store it securely, it is not shown again"`
+}
+
+// IntrospectionResponse is the RFC 7662 token introspection response
+// @Description Token introspection result; only "active" is set for inactive tokens
+type IntrospectionResponse struct {
+	Active    bool     `json:"active" example:"true" description:"Whether the token is valid and not revoked"`
+	Scope     string   `json:"scope,omitempty" example:"openid phone" description:"Granted scopes"`
+	ClientID  string   `json:"client_id,omitempty" example:"c_3f9a1b2c4d5e6f70" description:"Client the token was issued to"`
+	Username  string   `json:"username,omitempty" example:"+1234567890" description:"User's phone number"`
+	TokenType string   `json:"token_type,omitempty" example:"Bearer" description:"Token type"`
+	Exp       int64    `json:"exp,omitempty" example:"1755691200" description:"Expiration time (Unix seconds)"`
+	Iat       int64    `json:"iat,omitempty" example:"1755604800" description:"Issued at (Unix seconds)"`
+	Nbf       int64    `json:"nbf,omitempty" example:"1755604800" description:"Not before (Unix seconds)"`
+	Sub       string   `json:"sub,omitempty" example:"1" description:"User ID"`
+	Aud       []string `json:"aud,omitempty" description:"Token audiences"`
+	Iss       string   `json:"iss,omitempty" example:"otp-auth-service" description:"Token issuer"`
+	Jti       string   `json:"jti,omitempty" example:"q1w2e3r4t5y6u7i8o9p0aa" description:"Token ID"`
+	Roles     []string `json:"roles,omitempty" description:"User roles"`
+	// Act is set for impersonation tokens
+	Act *auth.Actor `json:"act,omitempty" description:"Staff member acting as the user (RFC 8693)"`
+}
+
+// SessionResponse is a login session as shown to its owner
+// @Description Login session with a flag for the session of the calling token
+type SessionResponse struct {
+	types.Session
+	Current bool `json:"current" example:"true" description:"Whether this is the session of the token used for the request"`
+}
+
+// SessionListResponse is the response for the session list endpoint
+// @Description Active sessions of the current user
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions" description:"Active sessions, most recently used first"`
+}
+
+// CreateAPIKeyResponse is the response for API key creation
+// @Description Created API key; the key is only returned once
+type CreateAPIKeyResponse struct {
+	types.APIKey
+	Key string `json:"key" example:"dk_Q2hhbmdlTWVQbGVhc2VUaGlzSXNOb3RBUmVhbEtleQ" description:"API key to send in the X-API-Key header; store it securely, it is not shown again"`
+}
+
+// APIKeyListResponse is the response for the API key list endpoint
+// @Description All API keys, including revoked and expired ones
+type APIKeyListResponse struct {
+	APIKeys []types.APIKey `json:"api_keys" description:"API keys, newest first"`
+}
+
+// TOTPEnrollmentResponse is the response for starting authenticator enrollment
+// @Description Authenticator app enrollment details; render provisioning_uri as a QR code
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP" description:"Base32 secret for manual entry"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/Dekamond:%2B1234567890?algorithm=SHA1&digits=6&issuer=Dekamond&period=30&secret=JBSWY3DPEHPK3PXP" description:"otpauth URI for QR provisioning"`
+}
+
+// PasskeyCreationOptionsResponse is the response for starting passkey registration
+// @Description Options to pass to navigator.credentials.create()
+type PasskeyCreationOptionsResponse struct {
+	PublicKey webauthn.CreationOptions `json:"publicKey" description:"PublicKeyCredentialCreationOptions with binary fields base64url encoded"`
+}
+
+// PasskeyRequestOptionsResponse is the response for starting a passkey login
+// @Description Options to pass to navigator.credentials.get()
+type PasskeyRequestOptionsResponse struct {
+	PublicKey webauthn.RequestOptions `json:"publicKey" description:"PublicKeyCredentialRequestOptions with the challenge base64url encoded"`
+}
+
+// PasskeyListResponse is the response for the passkey list endpoint
+// @Description Passkeys registered by the current user
+type PasskeyListResponse struct {
+	Passkeys []types.WebAuthnCredential `json:"passkeys" description:"Passkeys, newest first"`
+}
+
+// ImpersonationResponse is the response for the impersonation endpoint
+// @Description Short-lived token acting as the user
+type ImpersonationResponse struct {
+	Token     string    `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..." description:"Access token with an act claim"`
+	UserID    uint64    `json:"user_id" example:"42" description:"Impersonated user"`
+	ActorID   uint64    `json:"actor_id" example:"1" description:"Staff member the token was issued to"`
+	ExpiresAt time.Time `json:"expires_at" example:"2025-08-19T12:15:00Z" description:"Token expiry"`
+}
+
+// AccountDeletionResponse is the response for the account deletion endpoint
+// @Description Account deletion scheduled
+type AccountDeletionResponse struct {
+	Message             string    `json:"message" example:"Account scheduled for deletion" description:"Success message"`
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at" example:"2025-09-18T12:00:00Z" description:"When the account will be purged; logging in before then cancels the deletion"`
+}
+
+// LoginHistoryResponse is the response for the login history endpoints
+// @Description Login attempts, newest first
+type LoginHistoryResponse struct {
+	Logins []types.LoginEvent `json:"logins" description:"Login attempts, newest first"`
+	// NextBefore is set when older attempts may follow
+	NextBefore uint64 `json:"next_before,omitempty" example:"1234" description:"Pass as before to fetch older attempts"`
+}
+
+// AuditLogResponse is the response for the audit log endpoint
+// @Description Audit log entries, newest first
+type AuditLogResponse struct {
+	Entries []types.AuditEntry `json:"entries" description:"Audit log entries, newest first"`
+	// NextBefore is set when older entries may follow
+	NextBefore uint64 `json:"next_before,omitempty" example:"1000" description:"Pass as before to fetch older entries"`
+}
+
+// UserExportResponse describes a background user export
+// @Description Progress of a background user export
+type UserExportResponse struct {
+	ID         string     `json:"id" example:"q3Vx0bJ2Sx6Gm1d8Kc4y9w" description:"Export ID"`
+	Status     string     `json:"status" example:"completed" enums:"running,completed,failed" description:"Export status"`
+	Format     string     `json:"format" example:"csv" enums:"csv,ndjson" description:"Output format"`
+	Rows       int        `json:"rows" example:"125000" description:"Number of users written; 0 while running"`
+	Error      string     `json:"error,omitempty" example:"export failed" description:"Set when the export failed"`
+	CreatedAt  time.Time  `json:"created_at" example:"2024-08-19T12:00:00Z" description:"When the export was started"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" example:"2024-08-19T12:01:30Z" description:"When the export completed or failed"`
+	// ExpiresAt and DownloadURL are set once the export completed
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" example:"2024-08-20T12:01:30Z" description:"When the file will be removed"`
+	DownloadURL string     `json:"download_url,omitempty" example:"/v1/users/exports/q3Vx0bJ2Sx6Gm1d8Kc4y9w/download" description:"Where to download the file"`
+}
+
+// UserImportResponse reports the outcome of a user import
+// @Description Outcome of a user import, in total and per row
+type UserImportResponse struct {
+	userimport.Summary
+	Rows []userimport.Result `json:"rows" description:"Outcome of every row, in file order"`
+}
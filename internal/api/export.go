@@ -0,0 +1,573 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/otp"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/go-chi/chi/v5"
+)
+
+// ExportConfig configures user exports
+type ExportConfig struct {
+	// Dir holds the files written by async exports
+	Dir string
+	// Retention is how long a finished async export stays available for download
+	Retention time.Duration
+	// MaxRunning bounds the exports running at once, streamed and async together, since each
+	// holds a database connection and read transaction until it finishes
+	MaxRunning int
+}
+
+// exportFlushRows is how many rows are written between flushes to the client
+const exportFlushRows = 500
+
+// userExportFormats maps each export format to its content type
+var userExportFormats = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+}
+
+var userExportHeader = []string{
+	"id", "phone", "display_name", "email", "locale", "avatar_url", "status", "status_reason", "status_expires_at",
+	"created_at", "updated_at", "last_login_at", "deletion_scheduled_at", "deleted_at",
+}
+
+// userExport is what to export: the GetUsers filters and sort, and the output format
+type userExport struct {
+	filter db.UserFilter
+	sort   db.UserSort
+	format string
+}
+
+func parseUserExport(r *http.Request) (userExport, error) {
+	q := r.URL.Query()
+	export := userExport{format: q.Get("format")}
+	if export.format == "" {
+		export.format = "csv"
+	}
+	if _, ok := userExportFormats[export.format]; !ok {
+		return export, fmt.Errorf("format must be csv or ndjson")
+	}
+
+	var err error
+	if export.filter, err = parseUserFilter(q); err != nil {
+		return export, err
+	}
+	if export.sort, err = parseUserSort(q.Get("sort")); err != nil {
+		return export, err
+	}
+	return export, nil
+}
+
+// writeUsers writes the users of export to w and returns how many were written. Output is
+// buffered and handed to w, then flush is called, every exportFlushRows rows and at the end.
+func (h *Handler) writeUsers(ctx context.Context, w io.Writer, export userExport, flush func()) (int, error) {
+	bw := bufio.NewWriter(w)
+	var encode func(*types.User) error
+	var csvw *csv.Writer
+	if export.format == "csv" {
+		csvw = csv.NewWriter(bw)
+		if err := csvw.Write(userExportHeader); err != nil {
+			return 0, err
+		}
+		encode = func(u *types.User) error { return csvw.Write(userCSVRecord(u)) }
+	} else {
+		enc := json.NewEncoder(bw)
+		encode = func(u *types.User) error { return enc.Encode(u) }
+	}
+
+	flushAll := func() error {
+		if csvw != nil {
+			if csvw.Flush(); csvw.Error() != nil {
+				return csvw.Error()
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		flush()
+		return nil
+	}
+
+	n := 0
+	err := h.store.ExportUsers(ctx, export.filter, export.sort, func(u *types.User) error {
+		if err := encode(u); err != nil {
+			return err
+		}
+		n++
+		if n%exportFlushRows == 0 {
+			return flushAll()
+		}
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, flushAll()
+}
+
+// userCSVRecord returns the CSV row of u in the order of userExportHeader
+func userCSVRecord(u *types.User) []string {
+	return []string{
+		strconv.FormatUint(u.ID, 10), u.Phone,
+		csvText(u.DisplayName), csvText(u.Email), csvText(u.Locale), csvText(u.AvatarURL),
+		u.Status, csvText(u.StatusReason), csvTime(u.StatusExpiresAt),
+		csvTime(&u.CreatedAt), csvTime(&u.UpdatedAt), csvTime(u.LastLoginAt), csvTime(u.DeletionScheduledAt), csvTime(u.DeletedAt),
+	}
+}
+
+// csvText keeps text entered by users from being run as a formula by spreadsheet software
+func csvText(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// startedWriter records whether anything reached the client, after which errors can no longer
+// be sent as a JSON response
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
+
+// ExportUsers godoc
+// @Summary Export users
+// @Description Stream every user matching the GetUsers filters as CSV or NDJSON (requires users:export). Memory use is constant however many users match; closing the connection cancels the export. If the export fails midway the connection is aborted rather than ended, so a truncated file is never mistaken for a complete one. Use POST /users/exports to build the file in the background instead.
+// @Tags users
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param format query string false "Output format (default: csv)" Enums(csv, ndjson)
+// @Param search query string false "Search by phone number"
+// @Param country_code query string false "Calling code of the phone number, e.g. 98"
+// @Param created_from query string false "Registered at or after (RFC 3339)"
+// @Param created_to query string false "Registered before (RFC 3339)"
+// @Param status query string false "Account status" Enums(active, blocked, suspended)
+// @Param last_login_from query string false "Last logged in at or after (RFC 3339)"
+// @Param last_login_to query string false "Last logged in before (RFC 3339)"
+// @Param sort query string false "Sort field and direction, as for GET /users (default: created_at:desc)"
+// @Success 200 {string} string "One row or JSON object per user"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/export [get]
+func (h *Handler) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	export, err := parseUserExport(r)
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.exports.startStream() {
+		JSONError(w, "Too many exports running. Please try again later.", http.StatusTooManyRequests)
+		return
+	}
+	defer h.exports.endStream()
+
+	h.audit(r, types.AuditUsersExported, 0, map[string]any{"format": export.format, "query": r.URL.RawQuery})
+
+	w.Header().Set("Content-Type", userExportFormats[export.format])
+	w.Header().Set("Content-Disposition", `attachment; filename="users.`+export.format+`"`)
+	out := &startedWriter{w: w}
+	rc := http.NewResponseController(w)
+	start := time.Now()
+	rows, err := h.writeUsers(r.Context(), out, export, func() { _ = rc.Flush() })
+	switch {
+	case err == nil:
+		h.logger.Infow("users exported", "format", export.format, "rows", rows, "duration", time.Since(start))
+	case r.Context().Err() != nil:
+		h.logger.Infow("user export cancelled by client", "format", export.format, "rows", rows)
+	case !out.started:
+		w.Header().Del("Content-Disposition")
+		h.JSONErrorWithLog(w, "Failed to export users", http.StatusInternalServerError, err, "export users failed", "filter", export.filter)
+	default:
+		h.logger.Errorw("export users failed", "error", err, "filter", export.filter, "rows", rows)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Async export statuses
+const (
+	exportRunning   = "running"
+	exportCompleted = "completed"
+	exportFailed    = "failed"
+)
+
+// exportJob is an export being written to a file in the background
+type exportJob struct {
+	id        string
+	format    string
+	path      string
+	createdAt time.Time
+	cancel    context.CancelFunc
+
+	// guarded by exportJobs.mu
+	status     string
+	rows       int
+	err        string
+	finishedAt *time.Time
+}
+
+// exportJobs tracks the async exports of this instance; they do not survive a restart, and
+// SweepExportDir removes their files at the next start. It also counts the exports streamed to
+// clients, which share the cfg.MaxRunning slots with async ones.
+type exportJobs struct {
+	cfg       ExportConfig
+	mu        sync.Mutex
+	jobs      map[string]*exportJob
+	streaming int
+}
+
+func newExportJobs(cfg ExportConfig) *exportJobs {
+	return &exportJobs{cfg: cfg, jobs: map[string]*exportJob{}}
+}
+
+// add registers a new running job; it returns false if cfg.MaxRunning exports are already running
+func (e *exportJobs) add(job *exportJob) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running() >= e.cfg.MaxRunning {
+		return false
+	}
+	e.jobs[job.id] = job
+	return true
+}
+
+// startStream takes a slot for an export streamed to the client; it returns false if
+// cfg.MaxRunning exports are already running. A started stream must be ended with endStream.
+func (e *exportJobs) startStream() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running() >= e.cfg.MaxRunning {
+		return false
+	}
+	e.streaming++
+	return true
+}
+
+func (e *exportJobs) endStream() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.streaming--
+}
+
+// running counts the exports in progress; e.mu must be held
+func (e *exportJobs) running() int {
+	running := e.streaming
+	for _, j := range e.jobs {
+		if j.status == exportRunning {
+			running++
+		}
+	}
+	return running
+}
+
+func (e *exportJobs) get(id string) (*exportJob, dto.UserExportResponse, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	job, ok := e.jobs[id]
+	if !ok {
+		return nil, dto.UserExportResponse{}, false
+	}
+	resp := dto.UserExportResponse{
+		ID:         job.id,
+		Status:     job.status,
+		Format:     job.format,
+		Rows:       job.rows,
+		Error:      job.err,
+		CreatedAt:  job.createdAt,
+		FinishedAt: job.finishedAt,
+	}
+	if job.status == exportCompleted {
+		expiresAt := job.finishedAt.Add(e.cfg.Retention)
+		resp.ExpiresAt = &expiresAt
+		resp.DownloadURL = "/v1/users/exports/" + job.id + "/download"
+	}
+	return job, resp, true
+}
+
+// finish records the outcome of job and schedules its removal after the retention period
+func (e *exportJobs) finish(job *exportJob, rows int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Cancelled and removed while it was finishing
+	if e.jobs[job.id] != job {
+		os.Remove(job.path)
+		return
+	}
+	t := time.Now()
+	job.rows, job.finishedAt, job.status = rows, &t, exportCompleted
+	if err != nil {
+		job.status, job.err = exportFailed, "export failed"
+	}
+	time.AfterFunc(e.cfg.Retention, func() { e.remove(job.id) })
+}
+
+// remove cancels the job if it is running and deletes it with its file
+func (e *exportJobs) remove(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	job, ok := e.jobs[id]
+	if !ok {
+		return false
+	}
+	delete(e.jobs, id)
+	job.cancel()
+	os.Remove(job.path)
+	return true
+}
+
+// SweepExportDir removes the files a previous run left in cfg.Dir, whose jobs are gone with it:
+// exports interrupted while being written at once, finished ones when their retention has passed.
+// Only names written by exports are touched. It returns how many files were removed.
+func SweepExportDir(cfg ExportConfig) (int, error) {
+	entries, err := os.ReadDir(cfg.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		partial := strings.HasSuffix(name, ".partial")
+		format := strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(name, ".partial")), ".")
+		if _, ok := userExportFormats[format]; !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(cfg.Dir, name)
+		if remaining := cfg.Retention - time.Since(info.ModTime()); !partial && remaining > 0 {
+			time.AfterFunc(remaining, func() { os.Remove(path) })
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// StartUserExport godoc
+// @Summary Start a background user export
+// @Description Write every user matching the GetUsers filters to a CSV or NDJSON file on the server (requires users:export). Poll GET /users/exports/{id} until the status is completed, then fetch download_url. Finished exports are removed after the retention period, and exports are lost if the server restarts. Only a limited number of exports run at once; beyond it the request is refused with 429.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param format query string false "Output format (default: csv)" Enums(csv, ndjson)
+// @Param search query string false "Search by phone number"
+// @Param country_code query string false "Calling code of the phone number, e.g. 98"
+// @Param created_from query string false "Registered at or after (RFC 3339)"
+// @Param created_to query string false "Registered before (RFC 3339)"
+// @Param status query string false "Account status" Enums(active, blocked, suspended)
+// @Param last_login_from query string false "Last logged in at or after (RFC 3339)"
+// @Param last_login_to query string false "Last logged in before (RFC 3339)"
+// @Param sort query string false "Sort field and direction, as for GET /users (default: created_at:desc)"
+// @Success 202 {object} dto.UserExportResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/exports [post]
+func (h *Handler) StartUserExport(w http.ResponseWriter, r *http.Request) {
+	export, err := parseUserExport(r)
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := otp.RandomToken(16)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to start export", http.StatusInternalServerError, err, "generate export id failed")
+		return
+	}
+	if err := os.MkdirAll(h.exports.cfg.Dir, 0o700); err != nil {
+		h.JSONErrorWithLog(w, "Failed to start export", http.StatusInternalServerError, err, "create export dir failed", "dir", h.exports.cfg.Dir)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &exportJob{
+		id:        id,
+		format:    export.format,
+		path:      filepath.Join(h.exports.cfg.Dir, id+"."+export.format),
+		createdAt: time.Now(),
+		cancel:    cancel,
+		status:    exportRunning,
+	}
+	if !h.exports.add(job) {
+		cancel()
+		JSONError(w, "Too many exports running. Please try again later.", http.StatusTooManyRequests)
+		return
+	}
+
+	h.audit(r, types.AuditUsersExported, 0, map[string]any{"format": export.format, "query": r.URL.RawQuery, "export_id": id})
+	go h.runExport(ctx, job, export)
+
+	_, resp, _ := h.exports.get(id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// runExport writes job's file; it is renamed into place only once complete
+func (h *Handler) runExport(ctx context.Context, job *exportJob, export userExport) {
+	defer job.cancel()
+
+	partial := job.path + ".partial"
+	rows, err := h.writeExportFile(ctx, partial, export)
+	if err == nil {
+		err = os.Rename(partial, job.path)
+	}
+	if err != nil {
+		os.Remove(partial)
+		if !errors.Is(err, context.Canceled) {
+			h.logger.Errorw("background user export failed", "error", err, "export_id", job.id, "rows", rows)
+		}
+	} else {
+		h.logger.Infow("background user export completed", "export_id", job.id, "format", job.format, "rows", rows)
+	}
+	h.exports.finish(job, rows, err)
+}
+
+func (h *Handler) writeExportFile(ctx context.Context, path string, export userExport) (int, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := h.writeUsers(ctx, f, export, func() {})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return rows, err
+}
+
+// GetUserExport godoc
+// @Summary Get a background user export
+// @Description Report the progress of an export started with POST /users/exports (requires users:export)
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path string true "Export ID"
+// @Success 200 {object} dto.UserExportResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /users/exports/{id} [get]
+func (h *Handler) GetUserExport(w http.ResponseWriter, r *http.Request) {
+	_, resp, ok := h.exports.get(chi.URLParam(r, "id"))
+	if !ok {
+		JSONError(w, "Export not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DownloadUserExport godoc
+// @Summary Download a background user export
+// @Description Download the file of a completed export (requires users:export). Range requests are supported.
+// @Tags users
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path string true "Export ID"
+// @Success 200 {string} string "One row or JSON object per user"
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/exports/{id}/download [get]
+func (h *Handler) DownloadUserExport(w http.ResponseWriter, r *http.Request) {
+	job, resp, ok := h.exports.get(chi.URLParam(r, "id"))
+	if !ok {
+		JSONError(w, "Export not found", http.StatusNotFound)
+		return
+	}
+	if resp.Status != exportCompleted {
+		JSONError(w, "Export is "+resp.Status, http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(job.path)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to read export", http.StatusInternalServerError, err, "open export file failed", "export_id", job.id)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", userExportFormats[job.format])
+	w.Header().Set("Content-Disposition", `attachment; filename="users-`+job.id+`.`+job.format+`"`)
+	http.ServeContent(w, r, "", *resp.FinishedAt, f)
+}
+
+// CancelUserExport godoc
+// @Summary Cancel or delete a background user export
+// @Description Stop a running export, or delete the file of a finished one (requires users:export)
+// @Tags users
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path string true "Export ID"
+// @Success 204
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /users/exports/{id} [delete]
+func (h *Handler) CancelUserExport(w http.ResponseWriter, r *http.Request) {
+	if !h.exports.remove(chi.URLParam(r, "id")) {
+		JSONError(w, "Export not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportUsersStreams(t *testing.T) {
+	s := newTestServer(t)
+	token := s.admin()
+
+	rec := s.request(http.MethodGet, "/users/export?format=ndjson", token, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 1 {
+		t.Errorf("exported %d users, want the admin only", lines)
+	}
+}
+
+func TestExportUsersSharesTheRunningLimit(t *testing.T) {
+	s := newTestServer(t)
+	token := s.admin()
+
+	// The test server allows one export at a time; hold it as an async export would
+	if !s.handler.exports.startStream() {
+		t.Fatal("no export slot free")
+	}
+	if rec := s.request(http.MethodGet, "/users/export", token, nil, nil); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("export while another runs: status %d, want 429", rec.Code)
+	}
+	if s.handler.exports.add(&exportJob{id: "queued", status: exportRunning}) {
+		t.Fatal("async export started while a stream holds the only slot")
+	}
+
+	s.handler.exports.endStream()
+	if rec := s.request(http.MethodGet, "/users/export", token, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("export after the other finished: status %d: %s", rec.Code, rec.Body)
+	}
+	// The finished stream gave its slot back
+	if !s.handler.exports.startStream() {
+		t.Error("the slot of a finished export was not released")
+	}
+}
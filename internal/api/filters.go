@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// countryCodePattern matches an ITU calling code with an optional leading +
+var countryCodePattern = regexp.MustCompile(`^\+?[1-9][0-9]{0,2}$`)
+
+// parseUserFilter reads the user listing filters from query parameters
+func parseUserFilter(q url.Values) (db.UserFilter, error) {
+	filter := db.UserFilter{Search: q.Get("search")}
+
+	if code := q.Get("country_code"); code != "" {
+		if !countryCodePattern.MatchString(code) {
+			return filter, fmt.Errorf("country_code must be a calling code such as 98")
+		}
+		filter.CountryCode = strings.TrimPrefix(code, "+")
+	}
+
+	switch status := q.Get("status"); status {
+	case "", types.UserStatusActive, types.UserStatusBlocked, types.UserStatusSuspended:
+		filter.Status = status
+	default:
+		return filter, fmt.Errorf("status must be active, blocked or suspended")
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseTimeParam(q, "created_from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = parseTimeParam(q, "created_to"); err != nil {
+		return filter, err
+	}
+	if filter.LastLoginFrom, err = parseTimeParam(q, "last_login_from"); err != nil {
+		return filter, err
+	}
+	if filter.LastLoginTo, err = parseTimeParam(q, "last_login_to"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseTimeParam parses an optional RFC 3339 timestamp parameter
+func parseTimeParam(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return t, nil
+}
+
+// parseUserSort reads sort=field[:asc|:desc]; the field must be whitelisted by the store
+func parseUserSort(v string) (db.UserSort, error) {
+	if v == "" {
+		return db.DefaultUserSort, nil
+	}
+
+	field, direction, _ := strings.Cut(v, ":")
+	if !db.ValidUserSortField(field) {
+		return db.UserSort{}, fmt.Errorf("cannot sort by %q", field)
+	}
+	switch direction {
+	case "", "asc":
+		return db.UserSort{Field: field}, nil
+	case "desc":
+		return db.UserSort{Field: field, Desc: true}, nil
+	default:
+		return db.UserSort{}, fmt.Errorf("sort direction must be asc or desc")
+	}
+}
+
+func formatUserSort(sort db.UserSort) string {
+	if sort.Desc {
+		return sort.Field + ":desc"
+	}
+	return sort.Field + ":asc"
+}
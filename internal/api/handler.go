@@ -2,8 +2,12 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -11,20 +15,29 @@ import (
 	"github.com/MiladJlz/dekamond-task/internal/auth"
 	"github.com/MiladJlz/dekamond-task/internal/db"
 	"github.com/MiladJlz/dekamond-task/internal/otp"
+	"github.com/MiladJlz/dekamond-task/internal/types"
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
 type Handler struct {
-	store     *db.Store
-	otp       *otp.RedisOTP
-	jwtSecret string
-	logger    *zap.SugaredLogger
+	store    db.UserRepository
+	otp      *otp.RedisOTP
+	tokens   auth.TokenConfig
+	oidc     OIDCConfig
+	mfa      MFAConfig
+	passkeys PasskeyConfig
+	cookies  CookieConfig
+	accounts AccountConfig
+	exports  *exportJobs
+	imports  ImportConfig
+	auditLog auditLogStatus
+	logger   *zap.SugaredLogger
 }
 
 // NewHandler constructor
-func NewHandler(s *db.Store, r *otp.RedisOTP, jwtSecret string, logger *zap.SugaredLogger) *Handler {
-	return &Handler{store: s, otp: r, jwtSecret: jwtSecret, logger: logger}
+func NewHandler(s db.UserRepository, r *otp.RedisOTP, tokens auth.TokenConfig, oidc OIDCConfig, mfa MFAConfig, passkeys PasskeyConfig, cookies CookieConfig, accounts AccountConfig, exports ExportConfig, imports ImportConfig, logger *zap.SugaredLogger) *Handler {
+	return &Handler{store: s, otp: r, tokens: tokens, oidc: oidc, mfa: mfa, passkeys: passkeys, cookies: cookies, accounts: accounts, exports: newExportJobs(exports), imports: imports, logger: logger}
 }
 
 func JSONError(w http.ResponseWriter, message string, code int) {
@@ -55,8 +68,6 @@ func (h *Handler) JSONErrorWithLog(w http.ResponseWriter, publicMessage string,
 // @Failure 400 {object} dto.ErrorResponse
 // @Router /request-otp [post]
 func (h *Handler) RequestOTP(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-
 	var req dto.RequestOTPRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -68,37 +79,83 @@ func (h *Handler) RequestOTP(w http.ResponseWriter, r *http.Request) {
 		JSONError(w, "Phone number is required", http.StatusBadRequest)
 		return
 	}
+	phone, err := h.normalizePhone(req.Phone)
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	rateLimitStart := time.Now()
-	allowed, rlErr := h.otp.RateLimit(req.Phone)
-	if rlErr != nil {
-		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, rlErr, "rate limit error", "phone", req.Phone)
+	if err := h.sendOTP(r, phone, otp.PurposeLogin); err != nil {
+		if errors.Is(err, errRateLimited) {
+			JSONError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "send otp failed", "phone", phone)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(dto.RequestOTPResponse{Message: "OTP sent"})
+}
+
+var (
+	errRateLimited    = errors.New("rate limit exceeded")
+	errAccountBlocked = errors.New("account blocked")
+)
+
+// normalizePhone brings a phone number entered at login to the E.164 form users are stored
+// under, the same form user imports use, so each number maps to one account
+func (h *Handler) normalizePhone(phone string) (string, error) {
+	return types.NormalizePhone(phone, h.accounts.PhoneCountryCode)
+}
+
+// sendOTP applies the per-phone rate limit, shared by all purposes, and generates a new code for
+// purpose and phone, requested by r.
+// Blocked and suspended users get no code, but the caller cannot tell: answering differently
+// would let anyone probe which numbers have a blocked account.
+func (h *Handler) sendOTP(r *http.Request, phone string, purpose otp.Purpose) error {
+	start := time.Now()
+
+	rateLimitStart := time.Now()
+	allowed, err := h.otp.RateLimit(phone)
+	if err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
 	if !allowed {
-		JSONError(w, "Rate limit exceeded", http.StatusTooManyRequests)
-		return
+		return errRateLimited
 	}
 	rateLimitDuration := time.Since(rateLimitStart)
 
+	user, err := h.store.GetUserByPhone(phone)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("get user by phone: %w", err)
+	}
+	if user != nil && user.Restricted(time.Now()) {
+		h.logger.Warnw("otp refused for restricted account", "user_id", user.ID, "status", user.Status)
+		h.audit(r, types.AuditOTPRequested, user.ID, map[string]any{"sent": false, "reason": "blocked"})
+		return nil
+	}
+
 	generateStart := time.Now()
-	code, genErr := h.otp.Generate(req.Phone)
-	if genErr != nil {
-		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, genErr, "generate otp error", "phone", req.Phone)
-		return
+	code, err := h.otp.Generate(purpose, phone)
+	if err != nil {
+		return fmt.Errorf("generate otp: %w", err)
 	}
 	generateDuration := time.Since(generateStart)
 
-	h.logger.Infow("otp generated", "phone", req.Phone, "code", code)
+	h.logger.Infow("otp generated", "phone", phone, "code", code)
+	if user != nil {
+		h.audit(r, types.AuditOTPRequested, user.ID, map[string]any{"sent": true})
+	} else {
+		h.audit(r, types.AuditOTPRequested, 0, h.withPhoneHash(map[string]any{"sent": true}, phone))
+	}
 	h.logger.Infow("otp request perf", "rate_limit_ms", rateLimitDuration.Milliseconds(), "generate_ms", generateDuration.Milliseconds(), "total_ms", time.Since(start).Milliseconds())
-
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(dto.RequestOTPResponse{Message: "OTP sent"})
+	return nil
 }
 
 // VerifyOTP godoc
 // @Summary Verify OTP
-// @Description Verify OTP and login/register user
+// @Description Verify OTP and login/register user. Users with an authenticator app get mfa_required and an mfa_token to complete at /verify-otp/totp
 // @Tags auth
 // @Accept  json
 // @Produce  json
@@ -106,6 +163,7 @@ func (h *Handler) RequestOTP(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} dto.VerifyOTPResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Router /verify-otp [post]
 func (h *Handler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 	var req dto.VerifyOTPRequest
@@ -120,50 +178,149 @@ func (h *Handler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	valid, valErr := h.otp.Validate(req.Phone, req.Code)
+	phone, err := h.normalizePhone(req.Phone)
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	audience, err := h.tokens.AudienceFor(req.ClientID)
+	if err != nil {
+		JSONError(w, "Unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	valid, valErr := h.otp.Validate(otp.PurposeLogin, phone, req.Code)
 	if valErr != nil {
-		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, valErr, "validate otp error", "phone", req.Phone)
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, valErr, "validate otp error", "phone", phone)
 		return
 	}
 
 	if !valid {
+		h.recordLogin(r, &types.LoginEvent{Phone: phone, Method: types.LoginMethodOTP, Outcome: types.LoginInvalidCode})
+		h.audit(r, types.AuditOTPFailed, 0, h.withPhoneHash(nil, phone))
 		JSONError(w, "Invalid OTP", http.StatusUnauthorized)
 		return
 	}
 
-	exists, err := h.store.UserExists(req.Phone)
+	user, created, err := h.findOrCreateUser(r, phone)
 	if err != nil {
-		h.JSONErrorWithLog(w, "Database temporarily unavailable. Please try again.", http.StatusInternalServerError, err, "user exists query failed", "phone", req.Phone)
+		h.JSONErrorWithLog(w, "Database temporarily unavailable. Please try again.", http.StatusInternalServerError, err, "find or create user failed", "phone", phone)
+		return
+	}
+	h.audit(r, types.AuditOTPVerified, user.ID, nil)
+	if user.Restricted(time.Now()) {
+		h.logger.Warnw("login refused for restricted account", "user_id", user.ID, "status", user.Status)
+		h.recordLogin(r, &types.LoginEvent{UserID: user.ID, Phone: user.Phone, Method: types.LoginMethodOTP, Outcome: types.LoginBlocked})
+		JSONError(w, "Account is blocked", http.StatusForbidden)
 		return
 	}
 
-	if !exists {
-		if err := h.store.CreateUser(req.Phone); err != nil {
-			h.JSONErrorWithLog(w, "Failed to create user", http.StatusInternalServerError, err, "create user failed", "phone", req.Phone)
-			return
-		}
-		h.logger.Infow("user created", "phone", req.Phone)
+	mfaToken, err := h.startMFAChallenge(&types.MFAChallenge{UserID: user.ID, ClientID: req.ClientID, Audience: audience, DeviceName: req.DeviceName})
+	if err != nil {
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "start mfa challenge failed", "user_id", user.ID)
+		return
+	}
+	if mfaToken != "" {
+		h.recordLogin(r, &types.LoginEvent{UserID: user.ID, Phone: user.Phone, Method: types.LoginMethodOTP, Outcome: types.LoginMFARequired})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(dto.VerifyOTPResponse{Message: "TOTP code required", MFARequired: true, MFAToken: mfaToken})
+		return
+	}
+
+	h.completeLogin(w, r, user, created, req.ClientID, audience, req.DeviceName, types.LoginMethodOTP, auth.AMROTP)
+}
+
+// completeLogin creates a session for a login by method and responds with an access token bound to it,
+// either in the body or, for cookie clients, in session cookies. newUser is passed on to the client
+// so it can show onboarding.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, user *types.User, newUser bool, clientID string, audience []string, deviceName, method string, amr []string) {
+	session, err := h.createSession(r, user, deviceName, method)
+	if errors.Is(err, errAccountBlocked) {
+		JSONError(w, "Account is blocked", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		h.JSONErrorWithLog(w, "Database temporarily unavailable. Please try again.", http.StatusInternalServerError, err, "create session failed", "user_id", user.ID)
+		return
 	}
 
-	token, err := auth.GenerateJWT(req.Phone, h.jwtSecret)
+	token, err := h.issueAccessToken(r, auth.TokenParams{
+		User:      user,
+		Audience:  audience,
+		SessionID: session.ID,
+		AMR:       amr,
+	})
 	if err != nil {
-		h.JSONErrorWithLog(w, "Failed to issue token", http.StatusInternalServerError, err, "jwt sign failed", "phone", req.Phone)
+		h.JSONErrorWithLog(w, "Failed to issue token", http.StatusInternalServerError, err, "issue token failed", "user_id", user.ID)
 		return
 	}
+
+	resp := dto.VerifyOTPResponse{Message: "Login success", Token: token, IsNewUser: newUser}
+	if h.cookies.enabledFor(clientID) {
+		csrf, err := h.setSessionCookies(w, token, session.ID)
+		if err != nil {
+			h.JSONErrorWithLog(w, "Failed to issue token", http.StatusInternalServerError, err, "set session cookies failed", "user_id", user.ID)
+			return
+		}
+		resp = dto.VerifyOTPResponse{Message: "Login success", CSRFToken: csrf, IsNewUser: newUser}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(dto.VerifyOTPResponse{Message: "Login success", Token: token})
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// findOrCreateUser returns the user for phone, registering them on first login, and reports
+// whether they were just registered
+func (h *Handler) findOrCreateUser(r *http.Request, phone string) (*types.User, bool, error) {
+	user, created, err := h.store.UpsertUser(phone)
+	if err != nil {
+		return nil, false, fmt.Errorf("upsert user: %w", err)
+	}
+
+	if created {
+		h.logger.Infow("user created", "user_id", user.ID, "phone", phone)
+		h.audit(r, types.AuditUserCreated, user.ID, nil)
+	}
+	return user, created, nil
+}
+
+// issueAccessToken mints an access token for request r, adding the user's roles and permissions to
+// the requested scopes
+func (h *Handler) issueAccessToken(r *http.Request, params auth.TokenParams) (string, error) {
+	roles, err := h.store.GetUserRoles(params.User.ID)
+	if err != nil {
+		return "", fmt.Errorf("get user roles: %w", err)
+	}
+
+	permissions, err := h.store.GetUserPermissions(params.User.ID)
+	if err != nil {
+		return "", fmt.Errorf("get user permissions: %w", err)
+	}
+
+	params.Roles = roles
+	params.Scopes = slices.Concat(params.Scopes, permissions)
+	token, err := auth.GenerateJWT(params, h.tokens)
+	if err != nil {
+		return "", err
+	}
+
+	h.audit(r, types.AuditTokenIssued, params.User.ID, map[string]any{"client_id": params.ClientID, "session_id": params.SessionID, "amr": params.AMR})
+	return token, nil
 }
 
 // GetUser godoc
 // @Summary Get user by ID
-// @Description Retrieve a single user by their ID
+// @Description Retrieve a single user by their ID. Users can read their own record; other records require users:read
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security APIKeyAuth
 // @Param id path int true "User ID"
 // @Success 200 {object} types.User
 // @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /users/{id} [get]
@@ -175,7 +332,18 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.store.GetUserByID(id)
+	principal, _ := GetPrincipalFromContext(r)
+	if id != principal.UserID && !principal.HasScope(auth.PermissionUsersRead) {
+		JSONError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Users reading their own record right after signing in must see it, replicas may lag
+	getUser := h.store.GetUserByID
+	if id == principal.UserID {
+		getUser = h.store.GetUserByIDPrimary
+	}
+	user, err := getUser(id)
 	if err != nil {
 		h.JSONErrorWithLog(w, "User not found", http.StatusNotFound, err, "get user by id failed", "id", id)
 
@@ -188,23 +356,33 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 // GetUsers godoc
 // @Summary Get users list
-// @Description Retrieve list of users with pagination and search
+// @Description Retrieve list of users with pagination, filters and sorting (requires users:list). Pass next_cursor from a previous page as cursor for stable paging while users sign up; offset paging is kept for compatibility.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security APIKeyAuth
+// @Param cursor query string false "Opaque cursor from next_cursor; takes the place of offset and must be used with the same sort"
 // @Param offset query int false "Offset for pagination (default: 0)"
 // @Param limit query int false "Limit for pagination (default: 10, max: 100)"
 // @Param search query string false "Search by phone number"
+// @Param country_code query string false "Calling code of the phone number, e.g. 98"
+// @Param created_from query string false "Registered at or after (RFC 3339)"
+// @Param created_to query string false "Registered before (RFC 3339)"
+// @Param status query string false "Account status" Enums(active, blocked, suspended)
+// @Param last_login_from query string false "Last logged in at or after (RFC 3339)"
+// @Param last_login_to query string false "Last logged in before (RFC 3339)"
+// @Param sort query string false "Sort field and direction: created_at, updated_at, last_login_at, phone or id, with :asc or :desc (default: created_at:desc)"
 // @Success 200 {object} dto.UserListResponse
 // @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /users [get]
 func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	offsetStr := r.URL.Query().Get("offset")
 	limitStr := r.URL.Query().Get("limit")
-	search := r.URL.Query().Get("search")
+	cursor := r.URL.Query().Get("cursor")
 
 	offset := 0
 	limit := 10
@@ -221,23 +399,57 @@ func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	users, err := h.store.GetUsers(limit, offset, search)
+	filter, err := parseUserFilter(r.URL.Query())
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sort, err := parseUserSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// One extra row tells whether another page follows
+	opts := db.UserListOptions{UserFilter: filter, Sort: sort, Limit: limit + 1, Offset: offset}
+	if cursor != "" {
+		if offsetStr != "" {
+			JSONError(w, "cursor and offset cannot be combined", http.StatusBadRequest)
+			return
+		}
+		after, err := decodeUserCursor(cursor, sort)
+		if err != nil {
+			JSONError(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		opts.After = after
+		offset = 0
+	}
+
+	users, err := h.store.GetUsers(opts)
 	if err != nil {
-		h.JSONErrorWithLog(w, "Failed to fetch users", http.StatusInternalServerError, err, "list users failed", "offset", offset, "limit", limit, "search", search)
+		h.JSONErrorWithLog(w, "Failed to fetch users", http.StatusInternalServerError, err, "list users failed", "offset", offset, "limit", limit, "filter", filter, "sort", formatUserSort(sort))
 		return
 	}
 
-	total, err := h.store.GetUsersCount(search)
+	var nextCursor string
+	if len(users) > limit {
+		users = users[:limit]
+		nextCursor = encodeUserCursor(sort, sort.CursorFor(&users[limit-1]))
+	}
+
+	total, err := h.store.GetUsersCount(filter)
 	if err != nil {
-		h.JSONErrorWithLog(w, "Failed to get total count", http.StatusInternalServerError, err, "count users failed", "search", search)
+		h.JSONErrorWithLog(w, "Failed to get total count", http.StatusInternalServerError, err, "count users failed", "filter", filter)
 		return
 	}
 
 	response := dto.UserListResponse{
-		Users:  users,
-		Total:  total,
-		Offset: offset,
-		Limit:  limit,
+		Users:      users,
+		Total:      total,
+		Offset:     offset,
+		Limit:      limit,
+		NextCursor: nextCursor,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -246,7 +458,7 @@ func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
 
 // HealthCheck godoc
 // @Summary Health check
-// @Description Check service health for PostgreSQL and Redis
+// @Description Check service health for PostgreSQL, its read replicas, Redis and the audit log writer. A replica that is down only degrades the service, since reads fall back to the primary; so does an audit append failing, since requests go on without their entry.
 // @Tags health
 // @Accept json
 // @Produce json
@@ -257,9 +469,9 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
 
-	pgErr := h.store.DB.PingContext(ctx)
+	pgErr := h.store.Ping(ctx)
 	if pgErr != nil {
-		h.logger.Errorw("postgres health check failed", "error", pgErr)
+		h.logger.Errorw("database health check failed", "error", pgErr)
 	}
 
 	redisErr := h.otp.PingRedis()
@@ -279,6 +491,24 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		Status:   "healthy",
 		Postgres: dto.ComponentHealth{Status: "up"},
 		Redis:    dto.ComponentHealth{Status: "up"},
+		AuditLog: h.auditLog.health(),
+	}
+	if resp.AuditLog.Status != "up" {
+		resp.Status = "degraded"
+	}
+	for _, replica := range h.store.Replicas() {
+		health := dto.ReplicaHealth{
+			Name:      replica.Name,
+			Status:    "up",
+			LagMillis: replica.Lag.Milliseconds(),
+			Error:     replica.Error,
+			CheckedAt: replica.CheckedAt,
+		}
+		if !replica.Healthy {
+			health.Status = "down"
+			resp.Status = "degraded"
+		}
+		resp.Replicas = append(resp.Replicas, health)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
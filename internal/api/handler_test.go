@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+func TestOTPLoginRegistersOnFirstLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	first := s.login("+989121234567")
+	if !first.IsNewUser || first.Token == "" {
+		t.Fatalf("first login = %+v, want a token for a new user", first)
+	}
+	second := s.login("+989121234567")
+	if second.IsNewUser {
+		t.Fatal("second login reported a new user")
+	}
+
+	rec := s.request(http.MethodGet, "/me", second.Token, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /me: status %d: %s", rec.Code, rec.Body)
+	}
+	var me types.User
+	decode(t, rec, &me)
+	if me.Phone != "+989121234567" {
+		t.Errorf("phone = %q, want +989121234567", me.Phone)
+	}
+}
+
+func TestOTPLoginRejectsWrongCode(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: "+989121234567"}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("request otp: status %d: %s", rec.Code, rec.Body)
+	}
+	code := s.code("+989121234567")
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	rec = s.request(http.MethodPost, "/verify-otp", "", dto.VerifyOTPRequest{Phone: "+989121234567", Code: wrong}, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("verify with a wrong code: status %d, want 401", rec.Code)
+	}
+	if _, err := s.store.GetUserByPhone("+989121234567"); err == nil {
+		t.Error("a wrong code registered the user")
+	}
+}
+
+func TestRequestOTPRateLimit(t *testing.T) {
+	s := newTestServer(t)
+
+	for i := 0; i < testRateLimit; i++ {
+		if rec := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: "+989121234567"}, nil); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d: %s", i+1, rec.Code, rec.Body)
+		}
+	}
+	rec := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: "+989121234567"}, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit: status %d, want 429", rec.Code)
+	}
+}
+
+func TestRequestOTPBlockedAccountLooksLikeAnyOther(t *testing.T) {
+	s := newTestServer(t)
+
+	user, _, err := s.store.UpsertUser("+989121234567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.SetUserStatus(user.ID, types.UserStatus{Status: types.UserStatusBlocked}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: "+989121234567"}, nil)
+	unknown := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: "+989127654321"}, nil)
+	if blocked.Code != unknown.Code || blocked.Body.String() != unknown.Body.String() {
+		t.Errorf("blocked account answered %d %q, unknown number %d %q", blocked.Code, blocked.Body, unknown.Code, unknown.Body)
+	}
+	if s.code("+989121234567") != "" {
+		t.Error("a code was sent to a blocked account")
+	}
+}
+
+func TestOTPLoginNormalizesPhone(t *testing.T) {
+	s := newTestServerWith(t, testConfig{phoneCountryCode: "98"})
+
+	first := s.login("0912 123 4567")
+	// Within the rate limit, which also counts the number in any form
+	for _, phone := range []string{"+98 912 123 4567", "0098-912-123-4567"} {
+		if resp := s.login(phone); resp.IsNewUser {
+			t.Errorf("login as %s created a second account", phone)
+		}
+	}
+	if !first.IsNewUser {
+		t.Error("first login did not register the user")
+	}
+	if _, err := s.store.GetUserByPhone("+989121234567"); err != nil {
+		t.Errorf("user not stored under the E.164 number: %v", err)
+	}
+}
+
+func TestOTPLoginRejectsLocalNumberWithoutCountryCode(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: "09121234567"}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxImpersonationReasonLength bounds the free-text justification stored in the audit log
+const maxImpersonationReasonLength = 500
+
+// ImpersonatedByHeader is set on responses to impersonated requests so frontends can show a banner
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+// ImpersonateUser godoc
+// @Summary Impersonate a user
+// @Description Mint a short-lived token acting as the user, for support staff (requires users:impersonate and a recent authentication). The token carries an RFC 8693 act claim, cannot perform sensitive actions, and every use of this endpoint is audited.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param body body dto.ImpersonateRequest true "Support justification"
+// @Success 200 {object} dto.ImpersonationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/{id}/impersonate [post]
+func (h *Handler) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	targetID, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if targetID == principal.UserID {
+		JSONError(w, "Cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	var req dto.ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > maxImpersonationReasonLength {
+		JSONError(w, "A reason of at most 500 characters is required", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.store.GetUserByIDPrimary(targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		JSONError(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to impersonate user", http.StatusInternalServerError, err, "get user by id failed", "id", targetID)
+		return
+	}
+
+	// Staff may only act as users with no more permissions than their own, so impersonation never escalates
+	permissions, err := h.store.GetUserPermissions(targetID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to impersonate user", http.StatusInternalServerError, err, "get user permissions failed", "id", targetID)
+		return
+	}
+	for _, permission := range permissions {
+		if !principal.HasScope(permission) {
+			h.logger.Warnw("impersonation denied", "actor_id", principal.UserID, "target_id", targetID, "permission", permission)
+			JSONError(w, "Cannot impersonate a user with permissions you do not hold", http.StatusForbidden)
+			return
+		}
+	}
+
+	tokenID, err := auth.NewTokenID()
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to issue token", http.StatusInternalServerError, err, "generate token id failed")
+		return
+	}
+
+	// The audit entry is written before the token exists, so no impersonation goes unrecorded
+	event := &types.ImpersonationEvent{
+		ActorID:   principal.UserID,
+		TargetID:  targetID,
+		Reason:    req.Reason,
+		TokenID:   tokenID,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: time.Now().Add(h.tokens.ImpersonationTTL),
+	}
+	if err := h.store.CreateImpersonationEvent(event); err != nil {
+		h.JSONErrorWithLog(w, "Failed to impersonate user", http.StatusInternalServerError, err, "write impersonation audit failed", "actor_id", principal.UserID, "target_id", targetID)
+		return
+	}
+
+	audience, _ := h.tokens.AudienceFor("")
+	token, err := h.issueAccessToken(r, auth.TokenParams{
+		User:     target,
+		Audience: audience,
+		ID:       tokenID,
+		ActorID:  principal.UserID,
+		TTL:      h.tokens.ImpersonationTTL,
+	})
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to issue token", http.StatusInternalServerError, err, "issue token failed", "user_id", targetID)
+		return
+	}
+
+	h.logger.Infow("impersonation started", "actor_id", principal.UserID, "target_id", targetID, "audit_id", event.ID, "jti", tokenID)
+	h.audit(r, types.AuditUserImpersonated, targetID, map[string]any{"reason": req.Reason, "jti": tokenID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(dto.ImpersonationResponse{
+		Token:     token,
+		UserID:    targetID,
+		ActorID:   principal.UserID,
+		ExpiresAt: event.ExpiresAt,
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/MiladJlz/dekamond-task/internal/userimport"
+)
+
+// ImportConfig configures user imports through the API
+type ImportConfig struct {
+	// MaxBytes bounds the request body; larger files can be loaded with the import command
+	MaxBytes  int64
+	BatchSize int
+}
+
+// ImportUsers godoc
+// @Summary Import users
+// @Description Create users in bulk from a CSV file (header row with phone and optionally display_name, email, locale, avatar_url, created_at) or NDJSON with the same keys (requires users:import). Phones are normalized to E.164, as at login, and rows are validated like profile updates. Valid rows are loaded in batches; phones that are already registered, or repeated in the file, are skipped. The response reports the outcome of every row. Batches loaded before a failure are kept, so a failed import can be sent again.
+// @Tags users
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param format query string false "Input format (default: csv)" Enums(csv, ndjson)
+// @Param country_code query string false "Calling code given to phone numbers without one, e.g. 98 (default: PHONE_COUNTRY_CODE); without either such rows are invalid"
+// @Param file body string true "CSV or NDJSON file"
+// @Success 200 {object} dto.UserImportResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/import [post]
+func (h *Handler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := userimport.Options{Format: q.Get("format"), DefaultCountryCode: h.accounts.PhoneCountryCode, BatchSize: h.imports.BatchSize}
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	if code := q.Get("country_code"); code != "" {
+		if !countryCodePattern.MatchString(code) {
+			JSONError(w, "country_code must be a calling code such as 98", http.StatusBadRequest)
+			return
+		}
+		opts.DefaultCountryCode = strings.TrimPrefix(code, "+")
+	}
+	if r.ContentLength > h.imports.MaxBytes {
+		JSONError(w, "File too large; use the import command", http.StatusRequestEntityTooLarge)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, h.imports.MaxBytes)
+
+	resp := dto.UserImportResponse{Rows: []userimport.Result{}}
+	summary, err := userimport.Import(r.Context(), h.store, body, opts, func(result userimport.Result) error {
+		resp.Rows = append(resp.Rows, result)
+		return nil
+	})
+	resp.Summary = summary
+
+	// Rows imported before a failure stay, so record them either way
+	if summary.Created > 0 || err == nil {
+		h.audit(r, types.AuditUsersImported, 0, map[string]any{
+			"format": opts.Format, "created": summary.Created, "skipped": summary.Skipped, "invalid": summary.Invalid,
+		})
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == nil:
+	case errors.Is(err, userimport.ErrInvalidFile):
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.As(err, &maxBytesErr):
+		JSONError(w, "File too large; use the import command", http.StatusRequestEntityTooLarge)
+		return
+	default:
+		h.JSONErrorWithLog(w, "Failed to import users", http.StatusInternalServerError, err, "import users failed",
+			"created", summary.Created, "skipped", summary.Skipped, "invalid", summary.Invalid)
+		return
+	}
+
+	h.logger.Infow("users imported", "format", opts.Format, "created", summary.Created, "skipped", summary.Skipped, "invalid", summary.Invalid)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/userimport"
+)
+
+func TestImportUsers(t *testing.T) {
+	s := newTestServerWith(t, testConfig{phoneCountryCode: "98"})
+	token := s.admin()
+	if _, _, err := s.store.UpsertUser("+989120000001"); err != nil {
+		t.Fatal(err)
+	}
+
+	csv := strings.Join([]string{
+		"phone,display_name,email",
+		"0912 111 1111,Jane Doe,jane@example.com",
+		"+98 912 111 1111,Jane Again,",
+		"09120000001,Existing,",
+		"123,Too Short,",
+		"+14155550100,,not-an-email",
+		"+14155550101,,",
+	}, "\n")
+	rec := s.request(http.MethodPost, "/users/import", token, csv, http.Header{"Content-Type": {"text/csv"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp dto.UserImportResponse
+	decode(t, rec, &resp)
+
+	want := []string{
+		userimport.StatusCreated, userimport.StatusSkipped, userimport.StatusSkipped,
+		userimport.StatusInvalid, userimport.StatusInvalid, userimport.StatusCreated,
+	}
+	if len(resp.Rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(resp.Rows), len(want), resp.Rows)
+	}
+	for i, row := range resp.Rows {
+		if row.Line != i+2 || row.Status != want[i] {
+			t.Errorf("row %d = %+v, want line %d %s", i, row, i+2, want[i])
+		}
+	}
+	if resp.Summary != (userimport.Summary{Created: 2, Skipped: 2, Invalid: 2}) {
+		t.Errorf("summary = %+v", resp.Summary)
+	}
+
+	// The imported user logs in to the same account under the local number
+	if login := s.login("0912 111 1111"); login.IsNewUser {
+		t.Error("an imported user got a second account at login")
+	}
+}
+
+func TestImportUsersNDJSON(t *testing.T) {
+	s := newTestServer(t)
+	token := s.admin()
+
+	body := `{"phone": "+989121111111", "locale": "fa-IR"}` + "\n\n" + `{"phone": "+989122222222", "nickname": "x"}` + "\n"
+	rec := s.request(http.MethodPost, "/users/import?format=ndjson", token, body, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp dto.UserImportResponse
+	decode(t, rec, &resp)
+	if resp.Summary != (userimport.Summary{Created: 1, Invalid: 1}) || resp.Rows[1].Line != 3 {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestImportUsersRejectsBadRequests(t *testing.T) {
+	s := newTestServerWith(t, testConfig{importMaxBytes: 64})
+	token := s.admin()
+
+	tests := []struct {
+		name  string
+		query string
+		body  string
+		want  int
+	}{
+		{"unknown column", "", "phone,password\n+989121111111,x\n", http.StatusBadRequest},
+		{"no phone column", "", "display_name\nJane\n", http.StatusBadRequest},
+		{"unknown format", "?format=xml", "<users/>", http.StatusBadRequest},
+		{"bad country code", "?country_code=0", "phone\n09121111111\n", http.StatusBadRequest},
+		{"too large", "", "phone\n" + strings.Repeat("+989121111111\n", 10), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.request(http.MethodPost, "/users/import"+tt.query, token, tt.body, nil)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+	if rec := s.request(http.MethodGet, "/users", token, nil, nil); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "+98912111") {
+		t.Error("a rejected import created users")
+	}
+}
+
+func TestImportUsersRequiresPermission(t *testing.T) {
+	s := newTestServer(t)
+	token := s.login("+989121234567").Token
+
+	if rec := s.request(http.MethodPost, "/users/import", token, "phone\n+989121111111\n", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", rec.Code)
+	}
+}
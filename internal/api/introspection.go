@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+)
+
+// Introspect godoc
+// @Summary Token introspection
+// @Description RFC 7662 introspection for resource servers. Requires confidential client credentials. Tokens for any audience are introspected; callers must check "aud".
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access token to introspect"
+// @Param token_type_hint formData string false "Ignored; only access tokens are supported"
+// @Param client_id formData string false "Client ID (when not using HTTP Basic authentication)"
+// @Param client_secret formData string false "Client secret (client_secret_post)"
+// @Success 200 {object} dto.IntrospectionResponse
+// @Failure 401 {object} dto.OAuthErrorResponse
+// @Router /introspect [post]
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		OAuthError(w, "invalid_request", "malformed form body", http.StatusBadRequest)
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	if !client.Confidential() {
+		OAuthError(w, "invalid_client", "introspection requires a confidential client", http.StatusUnauthorized)
+		return
+	}
+
+	resp := dto.IntrospectionResponse{Active: false}
+
+	// Resource servers introspect tokens minted for their own audiences, which this service may not accept itself
+	cfg := h.tokens
+	cfg.Audiences = nil
+
+	claims, _, err := h.validateAccessToken(r.PostForm.Get("token"), cfg)
+	if errors.Is(err, errRevocationCheck) {
+		h.logger.Errorw("introspection revocation check failed", "error", err)
+		OAuthError(w, "temporarily_unavailable", "", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		h.logger.Infow("introspected inactive token", "client_id", client.ID, "reason", err)
+	} else {
+		resp = dto.IntrospectionResponse{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Username:  claims.Phone,
+			TokenType: "Bearer",
+			Sub:       claims.Subject,
+			Aud:       claims.Audience,
+			Iss:       claims.Issuer,
+			Jti:       claims.ID,
+			Roles:     claims.Roles,
+			Act:       claims.Act,
+		}
+		if claims.ExpiresAt != nil {
+			resp.Exp = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			resp.Iat = claims.IssuedAt.Unix()
+		}
+		if claims.NotBefore != nil {
+			resp.Nbf = claims.NotBefore.Unix()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Revoke godoc
+// @Summary Token revocation
+// @Description RFC 7009 revocation. Tokens issued to a client can only be revoked by that client; tokens from /verify-otp can be revoked by any confidential client. Unknown or invalid tokens are ignored.
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access token to revoke"
+// @Param token_type_hint formData string false "Ignored; only access tokens are supported"
+// @Param client_id formData string false "Client ID (when not using HTTP Basic authentication)"
+// @Param client_secret formData string false "Client secret for confidential clients (client_secret_post)"
+// @Success 200 {string} string "Token revoked or ignored"
+// @Failure 401 {object} dto.OAuthErrorResponse
+// @Failure 503 {object} dto.OAuthErrorResponse
+// @Router /revoke [post]
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		OAuthError(w, "invalid_request", "malformed form body", http.StatusBadRequest)
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	cfg := h.tokens
+	cfg.Audiences = nil
+
+	claims, err := auth.ValidateJWT(r.PostForm.Get("token"), cfg)
+	if err != nil {
+		// RFC 7009 section 2.2: invalid tokens do not cause an error response
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	allowed := claims.ClientID == client.ID || (claims.ClientID == "" && client.Confidential())
+	if !allowed {
+		h.logger.Warnw("token revocation by foreign client ignored", "client_id", client.ID, "token_client_id", claims.ClientID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := h.revokeAccessToken(claims); err != nil {
+		h.logger.Errorw("revoke token failed", "error", err, "jti", claims.ID)
+		OAuthError(w, "temporarily_unavailable", "", http.StatusServiceUnavailable)
+		return
+	}
+
+	h.logger.Infow("token revoked", "jti", claims.ID, "sub", claims.Subject, "client_id", client.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// ForwardAuth godoc
+// @Summary Forward authentication
+// @Description Endpoint for nginx auth_request and Traefik ForwardAuth. Returns 200 with X-User-* headers for a valid, unrevoked Bearer token and 401 otherwise.
+// @Tags auth
+// @Security BearerAuth
+// @Success 200 {string} string "Authenticated; see X-User-Id, X-User-Phone, X-User-Roles, X-User-Scopes and, for impersonation tokens, X-User-Impersonator-Id headers"
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /auth/forward [get]
+func (h *Handler) ForwardAuth(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	w.Header().Set("X-User-Id", strconv.FormatUint(principal.UserID, 10))
+	w.Header().Set("X-User-Phone", principal.Phone)
+	w.Header().Set("X-User-Roles", strings.Join(principal.Roles, ","))
+	w.Header().Set("X-User-Scopes", strings.Join(principal.Scopes, " "))
+	if principal.Impersonated() {
+		w.Header().Set("X-User-Impersonator-Id", strconv.FormatUint(principal.ActorID, 10))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// loginPageData drives the OTP login form shown by the OIDC authorization endpoint
+type loginPageData struct {
+	RequestID  string
+	ClientName string
+	Phone      string
+	CodeSent   bool
+	Expired    bool
+	Error      string
+	// MFAToken is set once the SMS code was accepted and an authenticator code is required
+	MFAToken string
+	// IssuerURL prefixes the form actions
+	IssuerURL string
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input, button { margin: .5rem 0 1rem; padding: .5rem; font-size: 1rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+{{if .Expired}}
+<h1>Sign in</h1>
+<p class="error">This login request has expired. Please return to the application and try again.</p>
+{{else}}
+<h1>Sign in{{if .ClientName}} to {{.ClientName}}{{end}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .MFAToken}}
+<form method="post" action="{{.IssuerURL}}/authorize/totp">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label for="code">Enter the code from your authenticator app</label>
+<input id="code" name="code" inputmode="numeric" autocomplete="one-time-code" pattern="[0-9]{6}" required autofocus>
+<button type="submit">Sign in</button>
+</form>
+{{else if .CodeSent}}
+<form method="post" action="{{.IssuerURL}}/authorize/verify">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<input type="hidden" name="phone" value="{{.Phone}}">
+<label for="code">Enter the code sent to {{.Phone}}</label>
+<input id="code" name="code" inputmode="numeric" autocomplete="one-time-code" pattern="[0-9]{6}" required autofocus>
+<button type="submit">Sign in</button>
+</form>
+<form method="post" action="{{.IssuerURL}}/authorize/otp">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<input type="hidden" name="phone" value="{{.Phone}}">
+<button type="submit">Send a new code</button>
+</form>
+{{else}}
+<form method="post" action="{{.IssuerURL}}/authorize/otp">
+<input type="hidden" name="request_id" value="{{.RequestID}}">
+<label for="phone">Phone number</label>
+<input id="phone" name="phone" type="tel" autocomplete="tel" value="{{.Phone}}" required autofocus>
+<button type="submit">Send code</button>
+</form>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func (h *Handler) renderLoginPage(w http.ResponseWriter, code int, data loginPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(code)
+	data.IssuerURL = h.oidc.IssuerURL
+	if err := loginPage.Execute(w, data); err != nil {
+		h.logger.Errorw("render login page failed", "error", err)
+	}
+}
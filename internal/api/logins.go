@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxUserAgentLength bounds the user agent stored with a login event, in bytes
+const maxUserAgentLength = 512
+
+// recordLogin adds a login attempt from the client making request r to the login history.
+// Failures are logged and do not affect the login itself.
+func (h *Handler) recordLogin(r *http.Request, event *types.LoginEvent) {
+	event.IPAddress = clientIP(r)
+	event.UserAgent = truncate(r.UserAgent(), maxUserAgentLength)
+
+	if err := h.store.CreateLoginEvent(event); err != nil {
+		h.logger.Errorw("record login event failed", "error", err, "user_id", event.UserID, "outcome", event.Outcome)
+	}
+}
+
+// ListMyLogins godoc
+// @Summary List my login history
+// @Description List recent login attempts on the current user's account, including failed and blocked ones
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Number of attempts (default: 20, max: 100)"
+// @Param before query int false "Only attempts older than this event ID, from next_before"
+// @Success 200 {object} dto.LoginHistoryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/logins [get]
+func (h *Handler) ListMyLogins(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+	h.writeLoginHistory(w, r, principal.UserID)
+}
+
+// ListUserLogins godoc
+// @Summary List a user's login history
+// @Description List recent login attempts on a user's account (requires users:read)
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path int true "User ID"
+// @Param limit query int false "Number of attempts (default: 20, max: 100)"
+// @Param before query int false "Only attempts older than this event ID, from next_before"
+// @Success 200 {object} dto.LoginHistoryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/{id}/logins [get]
+func (h *Handler) ListUserLogins(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	h.writeLoginHistory(w, r, id)
+}
+
+// writeLoginHistory responds with a page of the login attempts of userID
+func (h *Handler) writeLoginHistory(w http.ResponseWriter, r *http.Request, userID uint64) {
+	limit, before, err := parseIDPage(r)
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.store.ListLoginEvents(userID, limit, before)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to fetch login history", http.StatusInternalServerError, err, "list login events failed", "user_id", userID)
+		return
+	}
+
+	resp := dto.LoginHistoryResponse{Logins: events}
+	if len(events) == limit {
+		resp.NextBefore = events[len(events)-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
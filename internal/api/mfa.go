@@ -0,0 +1,310 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/totp"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// MFAConfig configures authenticator app (TOTP) second factors
+type MFAConfig struct {
+	Cipher *totp.Cipher
+	// Issuer is the account issuer shown in authenticator apps
+	Issuer string
+	// ChallengeTTL is how long a user has to enter the TOTP code after the SMS code was accepted
+	ChallengeTTL time.Duration
+}
+
+// maxMFAAttempts is how many TOTP codes can be tried for a challenge before the login must restart
+const maxMFAAttempts = 5
+
+var (
+	errMFAChallengeExpired = errors.New("mfa challenge expired")
+	errInvalidTOTP         = errors.New("invalid totp code")
+)
+
+// EnrollTOTP godoc
+// @Summary Start authenticator enrollment
+// @Description Generate a new authenticator secret for the current user. It becomes a required second factor once confirmed. Requires a recent authentication.
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.TOTPEnrollmentResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/totp [post]
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to start enrollment", http.StatusInternalServerError, err, "generate totp secret failed")
+		return
+	}
+
+	encrypted, err := h.mfa.Cipher.Encrypt(secret, totpAAD(principal.UserID))
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to start enrollment", http.StatusInternalServerError, err, "encrypt totp secret failed")
+		return
+	}
+
+	if err := h.store.SaveTOTPEnrollment(principal.UserID, encrypted); err != nil {
+		if errors.Is(err, db.ErrConflict) {
+			JSONError(w, "An authenticator is already enrolled; remove it first", http.StatusConflict)
+			return
+		}
+		h.JSONErrorWithLog(w, "Failed to start enrollment", http.StatusInternalServerError, err, "save totp enrollment failed", "user_id", principal.UserID)
+		return
+	}
+
+	h.logger.Infow("totp enrollment started", "user_id", principal.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(dto.TOTPEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, h.mfa.Issuer, principal.Phone),
+	})
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm authenticator enrollment
+// @Description Confirm the pending authenticator with a code from the app; from then on logins require a TOTP code
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body dto.TOTPCodeRequest true "Authenticator code"
+// @Success 204 {string} string "Authenticator enabled"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/totp/confirm [post]
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	var req dto.TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+
+	enrollment, err := h.store.GetTOTPEnrollment(principal.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		JSONError(w, "No pending authenticator enrollment", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to confirm authenticator", http.StatusInternalServerError, err, "get totp enrollment failed", "user_id", principal.UserID)
+		return
+	}
+	if enrollment.Confirmed() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := h.checkTOTP(enrollment, req.Code); err != nil {
+		if errors.Is(err, errInvalidTOTP) {
+			JSONError(w, "Invalid code", http.StatusBadRequest)
+			return
+		}
+		h.JSONErrorWithLog(w, "Failed to confirm authenticator", http.StatusInternalServerError, err, "check totp failed", "user_id", principal.UserID)
+		return
+	}
+
+	h.logger.Infow("totp enrollment confirmed", "user_id", principal.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableTOTP godoc
+// @Summary Remove authenticator
+// @Description Remove the current user's authenticator app so logins only need the SMS code. Requires a recent authentication.
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 204 {string} string "Authenticator removed"
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/totp [delete]
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	removed, err := h.store.DeleteTOTPEnrollment(principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to remove authenticator", http.StatusInternalServerError, err, "delete totp enrollment failed", "user_id", principal.UserID)
+		return
+	}
+	if !removed {
+		JSONError(w, "No authenticator enrolled", http.StatusNotFound)
+		return
+	}
+
+	h.logger.Infow("totp enrollment removed", "user_id", principal.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyTOTP godoc
+// @Summary Complete login with authenticator code
+// @Description Second login step for users with an authenticator app: exchange the mfa_token from /verify-otp and a TOTP code for a JWT
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body dto.VerifyTOTPRequest true "Challenge token and authenticator code"
+// @Success 200 {object} dto.VerifyOTPResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
+// @Router /verify-otp/totp [post]
+func (h *Handler) VerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	var req dto.VerifyTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		JSONError(w, "mfa_token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := h.verifyMFAChallenge(req.MFAToken, req.Code, nil)
+	switch {
+	case errors.Is(err, errMFAChallengeExpired):
+		JSONError(w, "Login challenge expired; request a new OTP", http.StatusUnauthorized)
+		return
+	case errors.Is(err, errInvalidTOTP):
+		JSONError(w, "Invalid TOTP code", http.StatusUnauthorized)
+		return
+	case err != nil:
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "verify mfa challenge failed")
+		return
+	}
+
+	user, err := h.store.GetUserByIDPrimary(challenge.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Database temporarily unavailable. Please try again.", http.StatusInternalServerError, err, "get user by id failed", "user_id", challenge.UserID)
+		return
+	}
+
+	h.completeLogin(w, r, user, false, challenge.ClientID, challenge.Audience, challenge.DeviceName, types.LoginMethodTOTP, auth.AMRTOTP)
+}
+
+// startMFAChallenge returns a challenge token if the user has a confirmed authenticator,
+// or "" if the login can complete with the SMS code alone
+func (h *Handler) startMFAChallenge(challenge *types.MFAChallenge) (string, error) {
+	enrollment, err := h.store.GetTOTPEnrollment(challenge.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get totp enrollment: %w", err)
+	}
+	if !enrollment.Confirmed() {
+		return "", nil
+	}
+
+	return h.otp.SaveMFAChallenge(challenge, h.mfa.ChallengeTTL)
+}
+
+// verifyMFAChallenge checks a TOTP code for a pending challenge and consumes the challenge on success.
+// Too many wrong codes also consume it, forcing the login to start over with a new SMS code.
+// authReq is the authorization request being completed, nil outside /authorize; a challenge only
+// completes the login flow that started it.
+func (h *Handler) verifyMFAChallenge(token, code string, authReq *mfaAuthorization) (*types.MFAChallenge, error) {
+	challenge, err := h.otp.GetMFAChallenge(token)
+	if err != nil {
+		return nil, fmt.Errorf("get mfa challenge: %w", err)
+	}
+	if challenge == nil {
+		return nil, errMFAChallengeExpired
+	}
+	if !authReq.matches(challenge) {
+		h.logger.Warnw("mfa challenge used in another login flow", "user_id", challenge.UserID)
+		return nil, errMFAChallengeExpired
+	}
+
+	// Counted before the code is checked, so parallel guesses cannot outrun the limit
+	attempts, err := h.otp.CountMFAAttempt(token)
+	if err != nil {
+		return nil, fmt.Errorf("count mfa attempt: %w", err)
+	}
+	if attempts > maxMFAAttempts {
+		return nil, errMFAChallengeExpired
+	}
+
+	enrollment, err := h.store.GetTOTPEnrollment(challenge.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("get totp enrollment: %w", err)
+	}
+
+	if err := h.checkTOTP(enrollment, code); err != nil {
+		if !errors.Is(err, errInvalidTOTP) {
+			return nil, err
+		}
+		if attempts == maxMFAAttempts {
+			h.logger.Warnw("mfa challenge exhausted", "user_id", challenge.UserID)
+			if err := h.otp.DeleteMFAChallenge(token); err != nil {
+				h.logger.Errorw("delete mfa challenge failed", "error", err, "user_id", challenge.UserID)
+			}
+		}
+		return nil, errInvalidTOTP
+	}
+
+	if err := h.otp.DeleteMFAChallenge(token); err != nil {
+		h.logger.Warnw("delete mfa challenge failed", "error", err)
+	}
+	return challenge, nil
+}
+
+// mfaAuthorization identifies the /authorize request an MFA challenge belongs to
+type mfaAuthorization struct {
+	requestID string
+	clientID  string
+}
+
+// matches reports whether challenge was started by the same login flow as a
+func (a *mfaAuthorization) matches(challenge *types.MFAChallenge) bool {
+	if a == nil {
+		return challenge.AuthRequestID == ""
+	}
+	return challenge.AuthRequestID == a.requestID && challenge.ClientID == a.clientID
+}
+
+// checkTOTP validates code against the enrollment and marks its time step used so it cannot be replayed
+func (h *Handler) checkTOTP(enrollment *types.TOTPEnrollment, code string) error {
+	secret, err := h.mfa.Cipher.Decrypt(enrollment.SecretEncrypted, totpAAD(enrollment.UserID))
+	if err != nil {
+		return fmt.Errorf("decrypt totp secret: %w", err)
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return errInvalidTOTP
+	}
+
+	fresh, err := h.store.UseTOTPStep(enrollment.UserID, step)
+	if err != nil {
+		return fmt.Errorf("use totp step: %w", err)
+	}
+	if !fresh {
+		return errInvalidTOTP
+	}
+	return nil
+}
+
+// totpAAD binds an encrypted secret to its user
+func totpAAD(userID uint64) []byte {
+	return []byte("user:" + strconv.FormatUint(userID, 10))
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/totp"
+)
+
+// totpCode computes the code an authenticator app shows for secret at t (RFC 6238, SHA-1)
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha1.New, key)
+	_ = binary.Write(mac, binary.BigEndian, uint64(at.Unix()/totp.Period))
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(sum[offset:])&0x7fffffff%1_000_000)
+}
+
+// enrollTOTP stores a TOTP enrollment for a new user and returns the user's ID and the secret
+func (s *testServer) enrollTOTP(phone string) (uint64, string) {
+	s.t.Helper()
+
+	user, _, err := s.store.UpsertUser(phone)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	encrypted, err := s.handler.mfa.Cipher.Encrypt(secret, totpAAD(user.ID))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if err := s.store.SaveTOTPEnrollment(user.ID, encrypted); err != nil {
+		s.t.Fatal(err)
+	}
+	return user.ID, secret
+}
+
+func TestCheckTOTPRejectsReplay(t *testing.T) {
+	s := newTestServer(t)
+	userID, secret := s.enrollTOTP("+989121234567")
+	now := time.Now()
+
+	check := func(code string) error {
+		t.Helper()
+		enrollment, err := s.store.GetTOTPEnrollment(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.handler.checkTOTP(enrollment, code)
+	}
+
+	code := totpCode(t, secret, now)
+	if err := check(code); err != nil {
+		t.Fatalf("first use of the code: %v", err)
+	}
+	if err := check(code); !errors.Is(err, errInvalidTOTP) {
+		t.Fatalf("second use of the same code: %v, want errInvalidTOTP", err)
+	}
+	// Still within the skew window, but older than the step already used
+	if err := check(totpCode(t, secret, now.Add(-totp.Period*time.Second))); !errors.Is(err, errInvalidTOTP) {
+		t.Fatalf("code of the previous step: %v, want errInvalidTOTP", err)
+	}
+	if err := check(totpCode(t, secret, now.Add(totp.Period*time.Second))); err != nil {
+		t.Fatalf("code of the next step: %v", err)
+	}
+}
+
+func TestCheckTOTPRejectsWrongCode(t *testing.T) {
+	s := newTestServer(t)
+	userID, secret := s.enrollTOTP("+989121234567")
+
+	enrollment, err := s.store.GetTOTPEnrollment(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three steps ahead is outside the skew window even if a step boundary passes meanwhile
+	if err := s.handler.checkTOTP(enrollment, totpCode(t, secret, time.Now().Add(3*totp.Period*time.Second))); !errors.Is(err, errInvalidTOTP) {
+		t.Fatalf("checkTOTP: %v, want errInvalidTOTP", err)
+	}
+}
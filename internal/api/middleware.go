@@ -2,48 +2,262 @@ package api
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/MiladJlz/dekamond-task/internal/auth"
 )
 
-// JWTAuthMiddleware validates JWT tokens and adds user phone to request context
+// JWTAuthMiddleware validates JWT tokens and adds the authenticated principal to request context.
+// Without an Authorization header it falls back to the session cookie, which also requires a CSRF token
+// on state-changing requests.
 func (h *Handler) JWTAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
+		var tokenString string
+		fromCookie := false
 		if authHeader == "" {
-			JSONError(w, "Authorization header required", http.StatusUnauthorized)
-			return
+			cookie, err := r.Cookie(AccessTokenCookie)
+			if len(h.cookies.Clients) == 0 || err != nil || cookie.Value == "" {
+				JSONError(w, "Authorization header required", http.StatusUnauthorized)
+				return
+			}
+			tokenString, fromCookie = cookie.Value, true
+		} else {
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				JSONError(w, "Invalid authorization header format", http.StatusUnauthorized)
+				return
+			}
+			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
 		}
 
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			JSONError(w, "Invalid authorization header format", http.StatusUnauthorized)
+		claims, principal, err := h.validateAccessToken(tokenString, h.tokens)
+		if errors.Is(err, errRevocationCheck) {
+			h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "jwt revocation check failed")
+			return
+		}
+		if errors.Is(err, errAccountBlocked) {
+			JSONError(w, "Account is blocked", http.StatusForbidden)
 			return
 		}
-
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-		phone, err := auth.ValidateJWT(tokenString, h.jwtSecret)
 		if err != nil {
 			h.logger.Errorw("jwt validation failed", "error", err)
 			JSONError(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, "user_phone", phone)
+		ctx := withAccessClaims(auth.WithPrincipal(r.Context(), principal), claims)
+		if fromCookie {
+			if !h.validCSRFRequest(r, principal.SessionID) {
+				h.logger.Warnw("csrf check failed", "user_id", principal.UserID, "method", r.Method, "path", r.URL.Path)
+				JSONError(w, "CSRF token missing or invalid", http.StatusForbidden)
+				return
+			}
+			ctx = withCookieAuth(ctx)
+		}
 		r = r.WithContext(ctx)
 
-		h.logger.Infow("jwt validated", "phone", phone)
+		if principal.Impersonated() {
+			w.Header().Set(ImpersonatedByHeader, strconv.FormatUint(principal.ActorID, 10))
+			h.logger.Infow("impersonated request", "user_id", principal.UserID, "actor_id", principal.ActorID, "method", r.Method, "path", r.URL.Path)
+		}
+
+		h.logger.Infow("jwt validated", "user_id", principal.UserID)
+		next.ServeHTTP(w, r)
+	}
+}
+
+// APIKeyHeader carries API keys for service-to-service requests
+const APIKeyHeader = "X-API-Key"
+
+// AuthMiddleware accepts either an API key in the X-API-Key header or a Bearer JWT.
+// Routes about the calling user (/me) use JWTAuthMiddleware instead, since API keys have no user.
+func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	jwtAuth := h.JWTAuthMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		rawKey := r.Header.Get(APIKeyHeader)
+		if rawKey == "" {
+			jwtAuth(w, r)
+			return
+		}
+
+		key, err := h.store.GetAPIKeyByHash(auth.HashSecret(rawKey))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "api key lookup failed")
+			return
+		}
+		if err != nil || !key.Active(time.Now()) {
+			h.logger.Warnw("api key rejected", "prefix", apiKeyPrefix(rawKey))
+			JSONError(w, "Invalid or expired API key", http.StatusUnauthorized)
+			return
+		}
+
+		if err := h.store.TouchAPIKey(key.ID); err != nil {
+			h.logger.Warnw("api key last-used update failed", "error", err, "api_key_id", key.ID)
+		}
+
+		principal := &auth.Principal{APIKeyID: key.ID, Scopes: key.Scopes}
+		r = r.WithContext(auth.WithPrincipal(r.Context(), principal))
+
+		h.logger.Infow("api key validated", "api_key_id", key.ID)
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequirePermission only lets principals holding permission reach next. It must be wrapped
+// by JWTAuthMiddleware or AuthMiddleware, which put the principal in the request context.
+func (h *Handler) RequirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := GetPrincipalFromContext(r)
+		if !ok {
+			JSONError(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		if !principal.HasScope(permission) {
+			h.logger.Warnw("permission denied", "user_id", principal.UserID, "api_key_id", principal.APIKeyID, "permission", permission, "path", r.URL.Path)
+			JSONError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequireRecentAuth only lets users who authenticated within maxAge reach next, for sensitive
+// operations. Other callers get an RFC 9470 step-up challenge and should complete /me/step-up.
+// Impersonation tokens are always rejected. It must be wrapped by JWTAuthMiddleware.
+func (h *Handler) RequireRecentAuth(maxAge time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := GetPrincipalFromContext(r)
+		if !ok {
+			JSONError(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		if principal.Impersonated() {
+			h.rejectImpersonated(w, r, principal)
+			return
+		}
+
+		if !principal.AuthenticatedWithin(maxAge) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age=%d`,
+				int(maxAge.Seconds())))
+			JSONError(w, "Step-up authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RejectImpersonation keeps impersonation tokens away from actions only the user themselves may
+// take, such as managing credentials. It must be wrapped by JWTAuthMiddleware or AuthMiddleware.
+func (h *Handler) RejectImpersonation(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := GetPrincipalFromContext(r); ok && principal.Impersonated() {
+			h.rejectImpersonated(w, r, principal)
+			return
+		}
 		next.ServeHTTP(w, r)
 	}
 }
 
-// Optional: Add a helper function to get user phone from context
+func (h *Handler) rejectImpersonated(w http.ResponseWriter, r *http.Request, principal *auth.Principal) {
+	h.logger.Warnw("sensitive action blocked during impersonation", "user_id", principal.UserID, "actor_id", principal.ActorID, "method", r.Method, "path", r.URL.Path)
+	JSONError(w, "Not allowed while impersonating a user", http.StatusForbidden)
+}
+
+// GetPrincipalFromContext returns the authenticated principal set by JWTAuthMiddleware
+func GetPrincipalFromContext(r *http.Request) (*auth.Principal, bool) {
+	return auth.PrincipalFromContext(r.Context())
+}
+
+// GetUserPhoneFromContext returns the authenticated user's phone, or "" if unauthenticated
 func GetUserPhoneFromContext(r *http.Request) string {
-	if phone, ok := r.Context().Value("user_phone").(string); ok {
-		return phone
+	if p, ok := GetPrincipalFromContext(r); ok {
+		return p.Phone
 	}
 	return ""
 }
+
+var (
+	errTokenRevoked    = errors.New("token revoked")
+	errSessionRevoked  = errors.New("session revoked")
+	errRevocationCheck = errors.New("revocation check failed")
+)
+
+// validateAccessToken validates a token against cfg and rejects tokens that were revoked,
+// either individually or through their login session, and tokens of blocked users
+func (h *Handler) validateAccessToken(tokenString string, cfg auth.TokenConfig) (*auth.Claims, *auth.Principal, error) {
+	claims, err := auth.ValidateJWT(tokenString, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	principal, err := claims.Principal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if claims.ID != "" {
+		revoked, err := h.otp.IsTokenRevoked(claims.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", errRevocationCheck, err)
+		}
+		if revoked {
+			return nil, nil, errTokenRevoked
+		}
+	}
+
+	if principal.SessionID != 0 {
+		active, err := h.store.TouchSession(principal.SessionID, principal.UserID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", errRevocationCheck, err)
+		}
+		if !active {
+			return nil, nil, errSessionRevoked
+		}
+	}
+
+	// Checked on every request so a block applies at once, also to tokens without a session
+	if principal.UserID != 0 {
+		restricted, err := h.store.UserRestricted(principal.UserID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", errRevocationCheck, err)
+		}
+		if restricted {
+			return nil, nil, errAccountBlocked
+		}
+	}
+
+	return claims, principal, nil
+}
+
+type accessClaimsContextKey struct{}
+
+// withAccessClaims stores the claims of the access token that authenticated the request
+func withAccessClaims(ctx context.Context, claims *auth.Claims) context.Context {
+	return context.WithValue(ctx, accessClaimsContextKey{}, claims)
+}
+
+// accessClaims returns the claims of the access token that authenticated r, for handlers that
+// replace or revoke it
+func accessClaims(r *http.Request) (*auth.Claims, bool) {
+	claims, ok := r.Context().Value(accessClaimsContextKey{}).(*auth.Claims)
+	return claims, ok && claims != nil
+}
+
+// revokeAccessToken denylists the token described by claims for the rest of its lifetime
+func (h *Handler) revokeAccessToken(claims *auth.Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	return h.otp.RevokeToken(claims.ID, time.Until(claims.ExpiresAt.Time)+h.tokens.Leeway)
+}
@@ -0,0 +1,696 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/otp"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// OIDCConfig configures the OpenID Connect provider endpoints
+type OIDCConfig struct {
+	// IssuerURL is the public base URL the endpoints are served under, e.g. http://localhost:8080/v1
+	IssuerURL  string
+	SigningKey *auth.SigningKey
+	// CodeTTL is how long an authorization code can be exchanged at the token endpoint
+	CodeTTL time.Duration
+	// LoginTTL is how long the user has to complete the OTP login for an /authorize request
+	LoginTTL time.Duration
+}
+
+// supportedScopes are the OIDC scopes this provider understands; others are dropped from requests
+var supportedScopes = []string{"openid", "phone"}
+
+// OAuthError writes an RFC 6749 error response
+func OAuthError(w http.ResponseWriter, errorCode, description string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(dto.OAuthErrorResponse{Error: errorCode, ErrorDescription: description})
+}
+
+// OpenIDConfiguration godoc
+// @Summary OIDC discovery document
+// @Description OpenID Connect provider metadata
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} dto.OpenIDConfigurationResponse
+// @Router /.well-known/openid-configuration [get]
+func (h *Handler) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	issuer := h.oidc.IssuerURL
+	resp := dto.OpenIDConfigurationResponse{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   supportedScopes,
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "phone_number", "phone_number_verified"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		IntrospectionEndpoint:             issuer + "/introspect",
+		RevocationEndpoint:                issuer + "/revoke",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys used to verify ID tokens
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Router /jwks.json [get]
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.oidc.SigningKey.JWKS())
+}
+
+// Authorize godoc
+// @Summary OIDC authorization endpoint
+// @Description Start an authorization code flow with PKCE (S256) and render the OTP login page
+// @Tags oidc
+// @Produce html
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Registered client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string true "Space-delimited scopes, must include openid"
+// @Param state query string false "Opaque value returned to the client"
+// @Param nonce query string false "Value bound into the ID token"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {string} string "Login page"
+// @Failure 302 {string} string "Redirect to the client with an error"
+// @Failure 400 {object} dto.OAuthErrorResponse
+// @Router /authorize [get]
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	client, ok := h.lookupClient(w, q.Get("client_id"))
+	if !ok {
+		return
+	}
+
+	redirectURI := q.Get("redirect_uri")
+	if !client.AllowsRedirect(redirectURI) {
+		OAuthError(w, "invalid_request", "redirect_uri is not registered for this client", http.StatusBadRequest)
+		return
+	}
+
+	// From here on the redirect URI is trusted, so errors are reported back to the client
+	state := q.Get("state")
+	if q.Get("response_type") != "code" {
+		redirectWithError(w, r, redirectURI, state, "unsupported_response_type", "only the code response type is supported")
+		return
+	}
+
+	scopes := filterScopes(q.Get("scope"))
+	if !slices.Contains(scopes, "openid") {
+		redirectWithError(w, r, redirectURI, state, "invalid_scope", "the openid scope is required")
+		return
+	}
+
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		redirectWithError(w, r, redirectURI, state, "invalid_request", "PKCE with code_challenge_method S256 is required")
+		return
+	}
+
+	authReq := &types.AuthorizationRequest{
+		ClientID:      client.ID,
+		RedirectURI:   redirectURI,
+		Scope:         strings.Join(scopes, " "),
+		State:         state,
+		Nonce:         q.Get("nonce"),
+		CodeChallenge: q.Get("code_challenge"),
+	}
+	requestID, err := h.otp.SaveAuthorizationRequest(authReq, h.oidc.LoginTTL)
+	if err != nil {
+		h.logger.Errorw("save authorization request failed", "error", err, "client_id", client.ID)
+		redirectWithError(w, r, redirectURI, state, "temporarily_unavailable", "")
+		return
+	}
+
+	h.renderLoginPage(w, http.StatusOK, loginPageData{RequestID: requestID, ClientName: client.Name})
+}
+
+// AuthorizeRequestOTP godoc
+// @Summary Send OTP for an authorization request
+// @Description Login page step one: send an OTP to the phone number
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param request_id formData string true "Authorization request ID"
+// @Param phone formData string true "User's phone number"
+// @Success 200 {string} string "Login page asking for the code"
+// @Router /authorize/otp [post]
+func (h *Handler) AuthorizeRequestOTP(w http.ResponseWriter, r *http.Request) {
+	requestID := r.PostFormValue("request_id")
+	phone := strings.TrimSpace(r.PostFormValue("phone"))
+
+	authReq, client, ok := h.loadAuthorizationRequest(w, requestID)
+	if !ok {
+		return
+	}
+
+	data := loginPageData{RequestID: requestID, ClientName: client.Name, Phone: phone}
+	if phone == "" {
+		data.Error = "Phone number is required"
+		h.renderLoginPage(w, http.StatusBadRequest, data)
+		return
+	}
+	phone, err := h.normalizePhone(phone)
+	if err != nil {
+		data.Error = "Please enter a valid phone number."
+		h.renderLoginPage(w, http.StatusBadRequest, data)
+		return
+	}
+	data.Phone = phone
+
+	if err := h.sendOTP(r, phone, otp.PurposeLogin); err != nil {
+		if errors.Is(err, errRateLimited) {
+			data.Error = "Too many codes requested. Please try again later."
+			h.renderLoginPage(w, http.StatusTooManyRequests, data)
+			return
+		}
+		h.logger.Errorw("send otp failed", "error", err, "phone", phone, "client_id", authReq.ClientID)
+		data.Error = "Temporary service issue. Please try again."
+		h.renderLoginPage(w, http.StatusServiceUnavailable, data)
+		return
+	}
+
+	data.CodeSent = true
+	h.renderLoginPage(w, http.StatusOK, data)
+}
+
+// AuthorizeVerifyOTP godoc
+// @Summary Complete an authorization request
+// @Description Login page step two: verify the OTP and redirect back to the client with an authorization code
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param request_id formData string true "Authorization request ID"
+// @Param phone formData string true "User's phone number"
+// @Param code formData string true "6-digit OTP code"
+// @Success 302 {string} string "Redirect to the client with code and state"
+// @Router /authorize/verify [post]
+func (h *Handler) AuthorizeVerifyOTP(w http.ResponseWriter, r *http.Request) {
+	requestID := r.PostFormValue("request_id")
+	phone := strings.TrimSpace(r.PostFormValue("phone"))
+	code := strings.TrimSpace(r.PostFormValue("code"))
+
+	authReq, client, ok := h.loadAuthorizationRequest(w, requestID)
+	if !ok {
+		return
+	}
+
+	data := loginPageData{RequestID: requestID, ClientName: client.Name, Phone: phone, CodeSent: true}
+	if phone == "" || code == "" {
+		data.Error = "Phone and code are required"
+		h.renderLoginPage(w, http.StatusBadRequest, data)
+		return
+	}
+	phone, err := h.normalizePhone(phone)
+	if err != nil {
+		data.Error = "Please enter a valid phone number."
+		h.renderLoginPage(w, http.StatusBadRequest, data)
+		return
+	}
+	data.Phone = phone
+
+	valid, err := h.otp.Validate(otp.PurposeLogin, phone, code)
+	if err != nil {
+		h.logger.Errorw("validate otp error", "error", err, "phone", phone)
+		data.Error = "Temporary service issue. Please try again."
+		h.renderLoginPage(w, http.StatusServiceUnavailable, data)
+		return
+	}
+	if !valid {
+		h.recordLogin(r, &types.LoginEvent{Phone: phone, Method: types.LoginMethodOTP, Outcome: types.LoginInvalidCode})
+		h.audit(r, types.AuditOTPFailed, 0, h.withPhoneHash(nil, phone))
+		data.Error = "Invalid code"
+		h.renderLoginPage(w, http.StatusUnauthorized, data)
+		return
+	}
+
+	user, _, err := h.findOrCreateUser(r, phone)
+	if err != nil {
+		h.logger.Errorw("find or create user failed", "error", err, "phone", phone)
+		redirectWithError(w, r, authReq.RedirectURI, authReq.State, "server_error", "")
+		return
+	}
+	h.audit(r, types.AuditOTPVerified, user.ID, map[string]any{"client_id": authReq.ClientID})
+
+	mfaToken, err := h.startMFAChallenge(&types.MFAChallenge{UserID: user.ID, ClientID: authReq.ClientID, AuthRequestID: requestID})
+	if err != nil {
+		h.logger.Errorw("start mfa challenge failed", "error", err, "user_id", user.ID)
+		data.Error = "Temporary service issue. Please try again."
+		h.renderLoginPage(w, http.StatusServiceUnavailable, data)
+		return
+	}
+	if mfaToken != "" {
+		data.MFAToken = mfaToken
+		h.renderLoginPage(w, http.StatusOK, data)
+		return
+	}
+
+	h.finishAuthorization(w, r, requestID, authReq, client, user, types.LoginMethodOTP, auth.AMROTP)
+}
+
+// AuthorizeVerifyTOTP godoc
+// @Summary Complete an authorization request with an authenticator code
+// @Description Login page step three for users with an authenticator app: verify the TOTP code and redirect back to the client
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param request_id formData string true "Authorization request ID"
+// @Param mfa_token formData string true "Challenge token from the previous step"
+// @Param code formData string true "6-digit code from the authenticator app"
+// @Success 302 {string} string "Redirect to the client with code and state"
+// @Router /authorize/totp [post]
+func (h *Handler) AuthorizeVerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	requestID := r.PostFormValue("request_id")
+	mfaToken := r.PostFormValue("mfa_token")
+	code := strings.TrimSpace(r.PostFormValue("code"))
+
+	authReq, client, ok := h.loadAuthorizationRequest(w, requestID)
+	if !ok {
+		return
+	}
+
+	data := loginPageData{RequestID: requestID, ClientName: client.Name, MFAToken: mfaToken}
+	challenge, err := h.verifyMFAChallenge(mfaToken, code, &mfaAuthorization{requestID: requestID, clientID: authReq.ClientID})
+	switch {
+	case errors.Is(err, errMFAChallengeExpired):
+		// Start over from the phone step
+		data = loginPageData{RequestID: requestID, ClientName: client.Name, Error: "Your login attempt expired. Please start again."}
+		h.renderLoginPage(w, http.StatusUnauthorized, data)
+		return
+	case errors.Is(err, errInvalidTOTP):
+		data.Error = "Invalid code"
+		h.renderLoginPage(w, http.StatusUnauthorized, data)
+		return
+	case err != nil:
+		h.logger.Errorw("verify mfa challenge failed", "error", err)
+		data.Error = "Temporary service issue. Please try again."
+		h.renderLoginPage(w, http.StatusServiceUnavailable, data)
+		return
+	}
+
+	user, err := h.store.GetUserByIDPrimary(challenge.UserID)
+	if err != nil {
+		h.logger.Errorw("get user by id failed", "error", err, "user_id", challenge.UserID)
+		redirectWithError(w, r, authReq.RedirectURI, authReq.State, "server_error", "")
+		return
+	}
+
+	h.finishAuthorization(w, r, requestID, authReq, client, user, types.LoginMethodTOTP, auth.AMRTOTP)
+}
+
+// finishAuthorization creates the session for a completed login and redirects back to the client with a code
+func (h *Handler) finishAuthorization(w http.ResponseWriter, r *http.Request, requestID string, authReq *types.AuthorizationRequest, client *types.OAuthClient, user *types.User, method string, amr []string) {
+	session, err := h.createSession(r, user, client.Name, method)
+	if errors.Is(err, errAccountBlocked) {
+		redirectWithError(w, r, authReq.RedirectURI, authReq.State, "access_denied", "account is blocked")
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("create session failed", "error", err, "user_id", user.ID)
+		redirectWithError(w, r, authReq.RedirectURI, authReq.State, "server_error", "")
+		return
+	}
+
+	grant := &types.AuthorizationCode{
+		ClientID:      authReq.ClientID,
+		RedirectURI:   authReq.RedirectURI,
+		Scope:         authReq.Scope,
+		Nonce:         authReq.Nonce,
+		CodeChallenge: authReq.CodeChallenge,
+		UserID:        user.ID,
+		SessionID:     session.ID,
+		AuthTime:      time.Now(),
+		AMR:           amr,
+	}
+	authCode, err := h.otp.SaveAuthorizationCode(grant, h.oidc.CodeTTL)
+	if err != nil {
+		h.logger.Errorw("save authorization code failed", "error", err, "client_id", authReq.ClientID)
+		redirectWithError(w, r, authReq.RedirectURI, authReq.State, "temporarily_unavailable", "")
+		return
+	}
+
+	if err := h.otp.DeleteAuthorizationRequest(requestID); err != nil {
+		h.logger.Warnw("delete authorization request failed", "error", err)
+	}
+
+	h.logger.Infow("authorization code issued", "user_id", user.ID, "client_id", authReq.ClientID)
+
+	params := url.Values{"code": {authCode}}
+	if authReq.State != "" {
+		params.Set("state", authReq.State)
+	}
+	http.Redirect(w, r, appendQuery(authReq.RedirectURI, params), http.StatusFound)
+}
+
+// Token godoc
+// @Summary OIDC token endpoint
+// @Description Exchange an authorization code and PKCE verifier for an access token and ID token
+// @Tags oidc
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "Must be authorization_code"
+// @Param code formData string true "Authorization code"
+// @Param redirect_uri formData string true "Redirect URI used in the authorization request"
+// @Param code_verifier formData string true "PKCE code verifier"
+// @Param client_id formData string false "Client ID (when not using HTTP Basic authentication)"
+// @Param client_secret formData string false "Client secret for confidential clients (client_secret_post)"
+// @Success 200 {object} dto.TokenResponse
+// @Failure 400 {object} dto.OAuthErrorResponse
+// @Failure 401 {object} dto.OAuthErrorResponse
+// @Router /token [post]
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		OAuthError(w, "invalid_request", "malformed form body", http.StatusBadRequest)
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		OAuthError(w, "unsupported_grant_type", "only authorization_code is supported", http.StatusBadRequest)
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	grant, err := h.otp.ConsumeAuthorizationCode(r.PostForm.Get("code"))
+	if err != nil {
+		h.logger.Errorw("consume authorization code failed", "error", err)
+		OAuthError(w, "temporarily_unavailable", "", http.StatusServiceUnavailable)
+		return
+	}
+	if grant == nil || grant.ClientID != client.ID || grant.RedirectURI != r.PostForm.Get("redirect_uri") {
+		OAuthError(w, "invalid_grant", "authorization code is invalid or expired", http.StatusBadRequest)
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), grant.CodeChallenge) {
+		OAuthError(w, "invalid_grant", "code_verifier does not match code_challenge", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.store.GetUserByIDPrimary(grant.UserID)
+	if err != nil {
+		h.logger.Errorw("get user by id failed", "error", err, "user_id", grant.UserID)
+		OAuthError(w, "invalid_grant", "user no longer exists", http.StatusBadRequest)
+		return
+	}
+	if user.Restricted(time.Now()) {
+		OAuthError(w, "invalid_grant", "account is blocked", http.StatusBadRequest)
+		return
+	}
+
+	// The token always carries this service's audience so it is accepted at /userinfo, besides
+	// the audiences of the APIs the client calls
+	audience, _ := h.tokens.AudienceFor("")
+	audience = slices.Clone(audience)
+	for _, aud := range client.Audiences {
+		if !slices.Contains(audience, aud) {
+			audience = append(audience, aud)
+		}
+	}
+	scopes := strings.Fields(grant.Scope)
+
+	accessToken, err := h.issueAccessToken(r, auth.TokenParams{
+		User:      user,
+		Scopes:    scopes,
+		Audience:  audience,
+		ClientID:  client.ID,
+		SessionID: grant.SessionID,
+		AuthTime:  grant.AuthTime,
+		AMR:       grant.AMR,
+	})
+	if err != nil {
+		h.logger.Errorw("issue token failed", "error", err, "user_id", user.ID)
+		OAuthError(w, "server_error", "", http.StatusInternalServerError)
+		return
+	}
+
+	idToken, err := auth.GenerateIDToken(user, auth.IDTokenParams{
+		Issuer:       h.oidc.IssuerURL,
+		ClientID:     client.ID,
+		Nonce:        grant.Nonce,
+		AuthTime:     grant.AuthTime,
+		AMR:          grant.AMR,
+		IncludePhone: slices.Contains(scopes, "phone"),
+		TTL:          h.tokens.TTL,
+	}, h.oidc.SigningKey)
+	if err != nil {
+		h.logger.Errorw("id token sign failed", "error", err, "user_id", user.ID)
+		OAuthError(w, "server_error", "", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Infow("oidc tokens issued", "user_id", user.ID, "client_id", client.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(dto.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.tokens.TTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       grant.Scope,
+	})
+}
+
+// UserInfo godoc
+// @Summary OIDC userinfo endpoint
+// @Description Return claims about the user the access token was issued to
+// @Tags oidc
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.UserInfoResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.OAuthErrorResponse
+// @Router /userinfo [get]
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+	if !principal.HasScope("openid") {
+		OAuthError(w, "insufficient_scope", "the openid scope is required", http.StatusForbidden)
+		return
+	}
+
+	user, err := h.store.GetUserByIDPrimary(principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "User not found", http.StatusNotFound, err, "get user by id failed", "id", principal.UserID)
+		return
+	}
+
+	resp := dto.UserInfoResponse{Subject: strconv.FormatUint(user.ID, 10)}
+	if principal.HasScope("phone") {
+		resp.PhoneNumber = user.Phone
+		resp.PhoneNumberVerified = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RegisterClient godoc
+// @Summary Register OIDC client
+// @Description Register a client application for the authorization code flow (requires clients:write)
+// @Tags oidc
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body dto.RegisterClientRequest true "Client registration"
+// @Success 201 {object} dto.RegisterClientResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clients [post]
+func (h *Handler) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	var req dto.RegisterClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.RedirectURIs) == 0 {
+		JSONError(w, "Name and redirect_uris are required", http.StatusBadRequest)
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			JSONError(w, "redirect_uris must be absolute URIs without a fragment", http.StatusBadRequest)
+			return
+		}
+	}
+
+	clientID, err := otp.RandomToken(12)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to register client", http.StatusInternalServerError, err, "generate client id failed")
+		return
+	}
+
+	client := &types.OAuthClient{
+		ID:           "c_" + clientID,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Audiences:    req.Audiences,
+	}
+	if client.Audiences == nil {
+		client.Audiences = []string{}
+	}
+
+	var secret string
+	if req.Confidential {
+		if secret, err = otp.RandomToken(32); err != nil {
+			h.JSONErrorWithLog(w, "Failed to register client", http.StatusInternalServerError, err, "generate client secret failed")
+			return
+		}
+		client.SecretHash = auth.HashSecret(secret)
+	}
+
+	if err := h.store.CreateOAuthClient(client); err != nil {
+		h.JSONErrorWithLog(w, "Failed to register client", http.StatusInternalServerError, err, "create oauth client failed", "name", req.Name)
+		return
+	}
+
+	h.logger.Infow("oauth client registered", "client_id", client.ID, "by_user_id", principal.UserID)
+	h.audit(r, types.AuditClientRegistered, 0, map[string]any{"client_id": client.ID, "name": client.Name, "redirect_uris": client.RedirectURIs})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(dto.RegisterClientResponse{OAuthClient: *client, ClientSecret: secret})
+}
+
+// lookupClient loads a registered client, writing an OAuth error if it does not exist
+func (h *Handler) lookupClient(w http.ResponseWriter, clientID string) (*types.OAuthClient, bool) {
+	if clientID == "" {
+		OAuthError(w, "invalid_request", "client_id is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	client, err := h.store.GetOAuthClient(clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			OAuthError(w, "invalid_client", "unknown client", http.StatusBadRequest)
+			return nil, false
+		}
+		h.logger.Errorw("get oauth client failed", "error", err, "client_id", clientID)
+		OAuthError(w, "server_error", "", http.StatusInternalServerError)
+		return nil, false
+	}
+	return client, true
+}
+
+// authenticateClient identifies the client at the token endpoint via HTTP Basic or form credentials
+func (h *Handler) authenticateClient(w http.ResponseWriter, r *http.Request) (*types.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1: credentials are form-encoded before being placed in the header
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	client, ok := h.lookupClient(w, clientID)
+	if !ok {
+		return nil, false
+	}
+
+	if client.Confidential() && !auth.VerifySecret(secret, client.SecretHash) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+		OAuthError(w, "invalid_client", "client authentication failed", http.StatusUnauthorized)
+		return nil, false
+	}
+	return client, true
+}
+
+// loadAuthorizationRequest loads the pending /authorize request behind the login form
+func (h *Handler) loadAuthorizationRequest(w http.ResponseWriter, requestID string) (*types.AuthorizationRequest, *types.OAuthClient, bool) {
+	if requestID == "" {
+		h.renderLoginPage(w, http.StatusBadRequest, loginPageData{Expired: true})
+		return nil, nil, false
+	}
+
+	authReq, err := h.otp.GetAuthorizationRequest(requestID)
+	if err != nil {
+		h.logger.Errorw("get authorization request failed", "error", err)
+		h.renderLoginPage(w, http.StatusServiceUnavailable, loginPageData{Error: "Temporary service issue. Please try again."})
+		return nil, nil, false
+	}
+	if authReq == nil {
+		h.renderLoginPage(w, http.StatusBadRequest, loginPageData{Expired: true})
+		return nil, nil, false
+	}
+
+	client, err := h.store.GetOAuthClient(authReq.ClientID)
+	if err != nil {
+		h.logger.Errorw("get oauth client failed", "error", err, "client_id", authReq.ClientID)
+		h.renderLoginPage(w, http.StatusBadRequest, loginPageData{Expired: true})
+		return nil, nil, false
+	}
+	return authReq, client, true
+}
+
+// filterScopes keeps the supported scopes from a space-delimited scope parameter
+func filterScopes(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if slices.Contains(supportedScopes, s) && !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func redirectWithError(w http.ResponseWriter, r *http.Request, redirectURI, state, errorCode, description string) {
+	params := url.Values{"error": {errorCode}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	http.Redirect(w, r, appendQuery(redirectURI, params), http.StatusFound)
+}
+
+// appendQuery adds params to a URI that may already carry a query string
+func appendQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
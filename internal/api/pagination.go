@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/MiladJlz/dekamond-task/internal/db"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// userCursor is the payload of the opaque next_cursor; it records the sort it was issued for,
+// since a position is meaningless under a different order
+type userCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    uint64 `json:"id"`
+}
+
+// encodeUserCursor returns an opaque cursor for position in listings ordered by sort
+func encodeUserCursor(sort db.UserSort, position db.UserCursor) string {
+	raw, _ := json.Marshal(userCursor{Sort: formatUserSort(sort), Value: position.Value, ID: position.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeUserCursor parses a cursor produced by encodeUserCursor for the same sort and checks its
+// value has the type of the sort field
+func decodeUserCursor(cursor string, sort db.UserSort) (*db.UserCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var c userCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != formatUserSort(sort) {
+		return nil, errInvalidCursor
+	}
+	position := db.UserCursor{Value: c.Value, ID: c.ID}
+	if !sort.ValidCursor(position) {
+		return nil, errInvalidCursor
+	}
+	return &position, nil
+}
+
+// parseIDPage reads limit (default 20, max 100) and before for listings paged by descending ID
+func parseIDPage(r *http.Request) (limit int, before uint64, err error) {
+	limit = 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > 100 {
+			return 0, 0, errors.New("limit must be between 1 and 100")
+		}
+	}
+	if v := r.URL.Query().Get("before"); v != "" {
+		if before, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return 0, 0, errors.New("Invalid before")
+		}
+	}
+	return limit, before, nil
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/MiladJlz/dekamond-task/internal/webauthn"
+	"github.com/go-chi/chi/v5"
+)
+
+// PasskeyConfig configures WebAuthn passkey login
+type PasskeyConfig struct {
+	RelyingParty *webauthn.RelyingParty
+	// ChallengeTTL is how long a registration or login ceremony may take
+	ChallengeTTL time.Duration
+}
+
+// BeginPasskeyRegistration godoc
+// @Summary Start passkey registration
+// @Description Get options for navigator.credentials.create() to add a passkey to the current account. Requires a recent authentication.
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.PasskeyCreationOptionsResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/passkeys/register/options [post]
+func (h *Handler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	existing, err := h.store.ListWebAuthnCredentials(principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to start registration", http.StatusInternalServerError, err, "list passkeys failed", "user_id", principal.UserID)
+		return
+	}
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(existing))
+	for _, c := range existing {
+		exclude = append(exclude, webauthn.CredentialDescriptor{Type: "public-key", ID: c.CredentialID, Transports: c.Transports})
+	}
+
+	challenge, err := h.otp.SaveWebAuthnChallenge(&types.WebAuthnChallenge{
+		Ceremony: types.WebAuthnRegistration,
+		UserID:   principal.UserID,
+	}, h.passkeys.ChallengeTTL)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to start registration", http.StatusInternalServerError, err, "save webauthn challenge failed", "user_id", principal.UserID)
+		return
+	}
+
+	user := webauthn.UserEntity{ID: passkeyUserHandle(principal.UserID), Name: principal.Phone, DisplayName: principal.Phone}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(dto.PasskeyCreationOptionsResponse{
+		PublicKey: h.passkeys.RelyingParty.CreationOptions(challenge, user, exclude, h.passkeys.ChallengeTTL),
+	})
+}
+
+// FinishPasskeyRegistration godoc
+// @Summary Complete passkey registration
+// @Description Verify the credential created by the browser and save it as a passkey for the current account
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body dto.RegisterPasskeyRequest true "Created credential"
+// @Success 201 {object} types.WebAuthnCredential
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/passkeys/register [post]
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	var req dto.RegisterPasskeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+
+	challenge, token, ok := h.consumeWebAuthnChallenge(w, req.Credential.Response.ClientDataJSON, types.WebAuthnRegistration)
+	if !ok {
+		return
+	}
+	if challenge.UserID != principal.UserID {
+		JSONError(w, "Passkey challenge expired; start again", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := h.passkeys.RelyingParty.VerifyRegistration(&req.Credential, token)
+	if err != nil {
+		h.logger.Warnw("passkey registration rejected", "error", err, "user_id", principal.UserID)
+		JSONError(w, "Passkey could not be verified", http.StatusBadRequest)
+		return
+	}
+
+	name := truncate(req.Name, maxDeviceNameLength)
+
+	stored := &types.WebAuthnCredential{
+		UserID:       principal.UserID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		Name:         name,
+		Transports:   credential.Transports,
+	}
+	if err := h.store.CreateWebAuthnCredential(stored); err != nil {
+		if errors.Is(err, db.ErrConflict) {
+			JSONError(w, "Passkey already registered", http.StatusConflict)
+			return
+		}
+		h.JSONErrorWithLog(w, "Failed to save passkey", http.StatusInternalServerError, err, "create passkey failed", "user_id", principal.UserID)
+		return
+	}
+
+	h.logger.Infow("passkey registered", "user_id", principal.UserID, "passkey_id", stored.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(stored)
+}
+
+// ListPasskeys godoc
+// @Summary List passkeys
+// @Description List the passkeys registered by the current user
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.PasskeyListResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/passkeys [get]
+func (h *Handler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	passkeys, err := h.store.ListWebAuthnCredentials(principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to fetch passkeys", http.StatusInternalServerError, err, "list passkeys failed", "user_id", principal.UserID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(dto.PasskeyListResponse{Passkeys: passkeys})
+}
+
+// DeletePasskey godoc
+// @Summary Remove a passkey
+// @Description Remove one of the current user's passkeys. Requires a recent authentication.
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Passkey ID"
+// @Success 204 {string} string "Passkey removed"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/passkeys/{id} [delete]
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid passkey ID", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := h.store.DeleteWebAuthnCredential(id, principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to remove passkey", http.StatusInternalServerError, err, "delete passkey failed", "user_id", principal.UserID, "passkey_id", id)
+		return
+	}
+	if !removed {
+		JSONError(w, "Passkey not found", http.StatusNotFound)
+		return
+	}
+
+	h.logger.Infow("passkey removed", "user_id", principal.UserID, "passkey_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginPasskeyLogin godoc
+// @Summary Start passkey login
+// @Description Get options for navigator.credentials.get(). The browser offers the user's passkeys for this site.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body dto.PasskeyLoginOptionsRequest false "Optional client application"
+// @Success 200 {object} dto.PasskeyRequestOptionsResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
+// @Router /passkeys/login/options [post]
+func (h *Handler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req dto.PasskeyLoginOptionsRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+			return
+		}
+	}
+
+	audience, err := h.tokens.AudienceFor(req.ClientID)
+	if err != nil {
+		JSONError(w, "Unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := h.otp.SaveWebAuthnChallenge(&types.WebAuthnChallenge{
+		Ceremony: types.WebAuthnLogin,
+		ClientID: req.ClientID,
+		Audience: audience,
+	}, h.passkeys.ChallengeTTL)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "save webauthn challenge failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(dto.PasskeyRequestOptionsResponse{
+		PublicKey: h.passkeys.RelyingParty.RequestOptions(challenge, h.passkeys.ChallengeTTL),
+	})
+}
+
+// FinishPasskeyLogin godoc
+// @Summary Complete passkey login
+// @Description Verify the passkey assertion from the browser and log the user in. Passkeys are user-verified, so no TOTP code is asked for.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body dto.PasskeyLoginRequest true "Passkey assertion"
+// @Success 200 {object} dto.VerifyOTPResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
+// @Router /passkeys/login [post]
+func (h *Handler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req dto.PasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+
+	challenge, token, ok := h.consumeWebAuthnChallenge(w, req.Credential.Response.ClientDataJSON, types.WebAuthnLogin)
+	if !ok {
+		return
+	}
+
+	credential, err := h.store.GetWebAuthnCredential(req.Credential.RawID)
+	if errors.Is(err, sql.ErrNoRows) {
+		JSONError(w, "Unknown passkey", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		h.JSONErrorWithLog(w, "Database temporarily unavailable. Please try again.", http.StatusServiceUnavailable, err, "get passkey failed")
+		return
+	}
+
+	userHandle := req.Credential.Response.UserHandle
+	if len(userHandle) > 0 && !bytes.Equal(userHandle, passkeyUserHandle(credential.UserID)) {
+		h.logger.Warnw("passkey user handle mismatch", "passkey_id", credential.ID)
+		JSONError(w, "Unknown passkey", http.StatusUnauthorized)
+		return
+	}
+
+	signCount, err := h.passkeys.RelyingParty.VerifyAssertion(&req.Credential, token, credential.PublicKey, credential.SignCount)
+	if err != nil {
+		h.logger.Warnw("passkey login rejected", "error", err, "user_id", credential.UserID, "passkey_id", credential.ID)
+		JSONError(w, "Passkey could not be verified", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.store.UseWebAuthnCredential(credential.ID, signCount); err != nil {
+		h.logger.Warnw("passkey usage update failed", "error", err, "passkey_id", credential.ID)
+	}
+
+	user, err := h.store.GetUserByIDPrimary(credential.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Database temporarily unavailable. Please try again.", http.StatusInternalServerError, err, "get user by id failed", "user_id", credential.UserID)
+		return
+	}
+
+	h.completeLogin(w, r, user, false, challenge.ClientID, challenge.Audience, req.DeviceName, types.LoginMethodPasskey, auth.AMRPasskey)
+}
+
+// consumeWebAuthnChallenge loads the pending ceremony a response answers and returns it with its challenge,
+// writing the error response if there is none
+func (h *Handler) consumeWebAuthnChallenge(w http.ResponseWriter, clientDataJSON []byte, ceremony string) (*types.WebAuthnChallenge, string, bool) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		JSONError(w, "Invalid credential", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	challenge, err := h.otp.ConsumeWebAuthnChallenge(clientData.Challenge)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "consume webauthn challenge failed")
+		return nil, "", false
+	}
+	if challenge == nil || challenge.Ceremony != ceremony {
+		JSONError(w, "Passkey challenge expired; start again", http.StatusBadRequest)
+		return nil, "", false
+	}
+	return challenge, clientData.Challenge, true
+}
+
+// passkeyUserHandle is the WebAuthn user handle for a user; it carries no personal data
+func passkeyUserHandle(userID uint64) []byte {
+	return []byte(strconv.FormatUint(userID, 10))
+}
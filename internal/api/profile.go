@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// GetMe godoc
+// @Summary Get current user
+// @Description Get the current user's profile. The ETag header is required as If-Match when updating it.
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} types.User
+// @Header 200 {string} ETag "Profile version"
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me [get]
+func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	user, err := h.store.GetUserByIDPrimary(principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to fetch profile", http.StatusInternalServerError, err, "get user by id failed", "user_id", principal.UserID)
+		return
+	}
+
+	writeProfile(w, user)
+}
+
+// UpdateMe godoc
+// @Summary Update current user
+// @Description Update profile fields of the current user. Omitted fields are kept and empty strings clear a field. Send the ETag from GET /me as If-Match; a stale ETag gets 412.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param If-Match header string true "ETag from GET /me"
+// @Param body body dto.UpdateProfileRequest true "Profile fields to change"
+// @Success 200 {object} types.User
+// @Header 200 {string} ETag "New profile version"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 412 {object} dto.ErrorResponse
+// @Failure 428 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me [patch]
+func (h *Handler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		JSONError(w, "If-Match header required", http.StatusPreconditionRequired)
+		return
+	}
+
+	var req dto.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+
+	user, err := h.store.GetUserByIDPrimary(principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to update profile", http.StatusInternalServerError, err, "get user by id failed", "user_id", principal.UserID)
+		return
+	}
+	if !etagMatches(ifMatch, profileETag(user)) {
+		JSONError(w, "Profile was modified; fetch it again", http.StatusPreconditionFailed)
+		return
+	}
+
+	profile, err := applyProfileUpdate(user.UserProfile, req)
+	if err != nil {
+		JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.store.UpdateUserProfile(user.ID, profile, user.UpdatedAt)
+	if errors.Is(err, db.ErrConflict) {
+		JSONError(w, "Profile was modified; fetch it again", http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to update profile", http.StatusInternalServerError, err, "update profile failed", "user_id", principal.UserID)
+		return
+	}
+
+	h.logger.Infow("profile updated", "user_id", principal.UserID)
+	writeProfile(w, updated)
+}
+
+func writeProfile(w http.ResponseWriter, user *types.User) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", profileETag(user))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+// profileETag derives the profile version from updated_at, which Postgres stores with microsecond precision
+func profileETag(user *types.User) string {
+	return `"` + strconv.FormatInt(user.UpdatedAt.UnixMicro(), 36) + `"`
+}
+
+// etagMatches evaluates an If-Match header (RFC 9110 §13.1.1) against the current ETag
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// applyProfileUpdate merges the requested changes into profile and validates the result
+func applyProfileUpdate(profile types.UserProfile, req dto.UpdateProfileRequest) (types.UserProfile, error) {
+	var err error
+	if req.DisplayName != nil {
+		if profile.DisplayName, err = types.NormalizeDisplayName(*req.DisplayName); err != nil {
+			return profile, err
+		}
+	}
+	if req.Email != nil {
+		if profile.Email, err = types.NormalizeEmail(*req.Email); err != nil {
+			return profile, err
+		}
+	}
+	if req.Locale != nil {
+		if profile.Locale, err = types.NormalizeLocale(*req.Locale); err != nil {
+			return profile, err
+		}
+	}
+	if req.AvatarURL != nil {
+		if profile.AvatarURL, err = types.NormalizeAvatarURL(*req.AvatarURL); err != nil {
+			return profile, err
+		}
+	}
+	return profile, nil
+}
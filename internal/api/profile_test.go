@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+func TestUpdateMeRequiresCurrentETag(t *testing.T) {
+	s := newTestServer(t)
+	token := s.login("+989121234567").Token
+
+	rec := s.request(http.MethodGet, "/me", token, nil, nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET /me: status %d, ETag %q", rec.Code, etag)
+	}
+
+	name := "Sara Ahmadi"
+	update := dto.UpdateProfileRequest{DisplayName: &name}
+	if rec := s.request(http.MethodPatch, "/me", token, update, nil); rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("PATCH without If-Match: status %d, want 428", rec.Code)
+	}
+
+	rec = s.request(http.MethodPatch, "/me", token, update, http.Header{"If-Match": {etag}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH with the current ETag: status %d: %s", rec.Code, rec.Body)
+	}
+	newETag := rec.Header().Get("ETag")
+	var user types.User
+	decode(t, rec, &user)
+	if user.DisplayName != name {
+		t.Errorf("display_name = %q, want %q", user.DisplayName, name)
+	}
+	if newETag == "" || newETag == etag {
+		t.Errorf("ETag after update = %q, want a new one (was %q)", newETag, etag)
+	}
+
+	other := "Someone Else"
+	rec = s.request(http.MethodPatch, "/me", token, dto.UpdateProfileRequest{DisplayName: &other}, http.Header{"If-Match": {etag}})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH with a stale ETag: status %d, want 412", rec.Code)
+	}
+	if rec := s.request(http.MethodGet, "/me", token, nil, nil); rec.Header().Get("ETag") != newETag {
+		t.Error("a stale update changed the profile")
+	}
+}
+
+func TestUpdateMeValidatesFields(t *testing.T) {
+	s := newTestServer(t)
+	token := s.login("+989121234567").Token
+	etag := s.request(http.MethodGet, "/me", token, nil, nil).Header().Get("ETag")
+
+	avatar := "http://example.com/a.png"
+	rec := s.request(http.MethodPatch, "/me", token, dto.UpdateProfileRequest{AvatarURL: &avatar}, http.Header{"If-Match": {etag}})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("PATCH with a plain HTTP avatar: status %d, want 400", rec.Code)
+	}
+}
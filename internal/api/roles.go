@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/go-chi/chi/v5"
+)
+
+// AssignUserRole godoc
+// @Summary Grant a role
+// @Description Grant a role to a user (requires roles:write). The caller must hold every permission the role grants. Takes effect on the user's next login.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path int true "User ID"
+// @Param role path string true "Role name"
+// @Success 204 {string} string "Role granted"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/{id}/roles/{role} [put]
+func (h *Handler) AssignUserRole(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	role := chi.URLParam(r, "role")
+
+	// Like API key scopes, a role can only be granted by someone who already holds what it grants
+	permissions, err := h.store.GetRolePermissions(role)
+	if errors.Is(err, db.ErrNotFound) {
+		JSONError(w, "User or role not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to grant role", http.StatusInternalServerError, err, "get role permissions failed", "role", role)
+		return
+	}
+	for _, permission := range permissions {
+		if !principal.HasScope(permission) {
+			JSONError(w, "Cannot grant a permission you do not hold: "+permission, http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := h.store.AssignRole(id, role); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			JSONError(w, "User or role not found", http.StatusNotFound)
+			return
+		}
+		h.JSONErrorWithLog(w, "Failed to grant role", http.StatusInternalServerError, err, "assign role failed", "user_id", id, "role", role)
+		return
+	}
+
+	h.logger.Infow("role granted", "user_id", id, "role", role, "by_user_id", principal.UserID)
+	h.audit(r, types.AuditRoleGranted, id, map[string]any{"role": role})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveUserRole godoc
+// @Summary Revoke a role
+// @Description Revoke a role from a user (requires roles:write). All of the user's sessions are revoked, so it takes effect at once.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path int true "User ID"
+// @Param role path string true "Role name"
+// @Success 204 {string} string "Role revoked"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/{id}/roles/{role} [delete]
+func (h *Handler) RemoveUserRole(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	role := chi.URLParam(r, "role")
+
+	removed, err := h.store.RemoveRole(id, role)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to revoke role", http.StatusInternalServerError, err, "remove role failed", "user_id", id, "role", role)
+		return
+	}
+	if !removed {
+		JSONError(w, "User does not have this role", http.StatusNotFound)
+		return
+	}
+
+	h.logger.Infow("role revoked", "user_id", id, "role", role, "by_user_id", principal.UserID)
+	h.audit(r, types.AuditRoleRevoked, id, map[string]any{"role": role})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/db/memory"
+	"github.com/MiladJlz/dekamond-task/internal/otp"
+	"github.com/MiladJlz/dekamond-task/internal/totp"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// testRateLimit is how many codes a phone can request in a test
+const testRateLimit = 3
+
+// testServer is a Handler on the in-memory store and an in-process Redis, serving the routes the
+// tests use as cmd/server mounts them
+type testServer struct {
+	t       *testing.T
+	store   *memory.Store
+	redis   *miniredis.Miniredis
+	handler *Handler
+	router  chi.Router
+}
+
+// testConfig holds the settings tests change; the rest is fixed
+type testConfig struct {
+	phoneCountryCode string
+	importMaxBytes   int64
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerWith(t, testConfig{})
+}
+
+func newTestServerWith(t *testing.T, cfg testConfig) *testServer {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	if cfg.importMaxBytes == 0 {
+		cfg.importMaxBytes = 1 << 20
+	}
+
+	s := &testServer{t: t, store: memory.New(), redis: mr}
+	tokens := auth.TokenConfig{
+		Secret:    "test-secret",
+		Issuer:    "test",
+		Audiences: []string{"test-api"},
+		TTL:       time.Hour,
+		Leeway:    time.Second,
+	}
+	cipher, err := totp.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(s.store, otp.NewRedisClient(mr.Addr(), time.Minute, testRateLimit, time.Minute), tokens,
+		OIDCConfig{}, MFAConfig{Cipher: cipher, ChallengeTTL: time.Minute}, PasskeyConfig{}, CookieConfig{},
+		AccountConfig{DeletionGracePeriod: time.Hour, PhoneCountryCode: cfg.phoneCountryCode},
+		ExportConfig{Dir: t.TempDir(), Retention: time.Hour, MaxRunning: 1},
+		ImportConfig{MaxBytes: cfg.importMaxBytes, BatchSize: 2},
+		zap.NewNop().Sugar())
+
+	s.handler = h
+
+	r := chi.NewRouter()
+	r.Post("/request-otp", h.RequestOTP)
+	r.Post("/verify-otp", h.VerifyOTP)
+	r.Get("/me", h.JWTAuthMiddleware(h.GetMe))
+	r.Patch("/me", h.JWTAuthMiddleware(h.RejectImpersonation(h.UpdateMe)))
+	r.Delete("/me", h.JWTAuthMiddleware(h.RejectImpersonation(h.DeleteMe)))
+	r.Post("/me/step-up/request-otp", h.JWTAuthMiddleware(h.RejectImpersonation(h.StepUpRequestOTP)))
+	r.Post("/me/step-up", h.JWTAuthMiddleware(h.RejectImpersonation(h.StepUpVerify)))
+	r.Get("/users", h.AuthMiddleware(h.RequirePermission(auth.PermissionUsersList, h.GetUsers)))
+	r.Get("/users/export", h.AuthMiddleware(h.RequirePermission(auth.PermissionUsersExport, h.ExportUsers)))
+	r.Post("/users/import", h.AuthMiddleware(h.RejectImpersonation(h.RequirePermission(auth.PermissionUsersImport, h.ImportUsers))))
+	s.router = r
+	return s
+}
+
+// request sends a request with an optional bearer token; body is sent as is if it is a string
+// and as JSON otherwise
+func (s *testServer) request(method, path, token string, body any, header http.Header) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encode request body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// code returns the login OTP last sent to phone, or "" if none is pending
+func (s *testServer) code(phone string) string {
+	code, err := s.redis.Get("otp:" + phone)
+	if err != nil {
+		return ""
+	}
+	return code
+}
+
+// stepUpCode returns the step-up OTP last sent to phone, or "" if none is pending
+func (s *testServer) stepUpCode(phone string) string {
+	code, err := s.redis.Get("otp:stepup:" + phone)
+	if err != nil {
+		return ""
+	}
+	return code
+}
+
+// login requests and verifies a code for phone, as typed by the user, and returns the response
+func (s *testServer) login(phone string) dto.VerifyOTPResponse {
+	s.t.Helper()
+
+	rec := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: phone}, nil)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("request otp for %s: status %d: %s", phone, rec.Code, rec.Body)
+	}
+	normalized, err := s.handler.normalizePhone(phone)
+	if err != nil {
+		s.t.Fatalf("normalize %s: %v", phone, err)
+	}
+
+	rec = s.request(http.MethodPost, "/verify-otp", "", dto.VerifyOTPRequest{Phone: phone, Code: s.code(normalized)}, nil)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("verify otp for %s: status %d: %s", phone, rec.Code, rec.Body)
+	}
+	var resp dto.VerifyOTPResponse
+	decode(s.t, rec, &resp)
+	return resp
+}
+
+// admin registers a user with the admin role and returns their token
+func (s *testServer) admin() string {
+	s.t.Helper()
+
+	const phone = "+15550000001"
+	user, _, err := s.store.UpsertUser(phone)
+	if err != nil {
+		s.t.Fatalf("create admin: %v", err)
+	}
+	if err := s.store.AssignRole(user.ID, "admin"); err != nil {
+		s.t.Fatalf("grant admin: %v", err)
+	}
+	return s.login(phone).Token
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body, err)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxDeviceNameLength bounds client supplied device names stored with a session, in bytes
+const maxDeviceNameLength = 100
+
+// truncate shortens s to at most max bytes without splitting a UTF-8 sequence, which Postgres
+// would reject as text
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the devices the current user is logged in on
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.SessionListResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/sessions [get]
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	sessions, err := h.store.GetActiveSessions(principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to fetch sessions", http.StatusInternalServerError, err, "list sessions failed", "user_id", principal.UserID)
+		return
+	}
+
+	resp := dto.SessionListResponse{Sessions: make([]dto.SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, dto.SessionResponse{
+			Session: session,
+			Current: session.ID == principal.SessionID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log out one of the current user's devices; tokens issued for that session stop working immediately
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Success 204 {string} string "Session revoked"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /me/sessions/{id} [delete]
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := h.store.RevokeSession(id, principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to revoke session", http.StatusInternalServerError, err, "revoke session failed", "user_id", principal.UserID, "session_id", id)
+		return
+	}
+	if !revoked {
+		JSONError(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	h.logger.Infow("session revoked", "user_id", principal.UserID, "session_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createSession records a login by method from the device making request r, also in the login
+// history. Blocked and suspended users get errAccountBlocked. Logging in during the grace period
+// of a requested account deletion cancels it.
+func (h *Handler) createSession(r *http.Request, user *types.User, deviceName, method string) (*types.Session, error) {
+	if user.Restricted(time.Now()) {
+		h.logger.Warnw("login refused for restricted account", "user_id", user.ID, "status", user.Status)
+		h.recordLogin(r, &types.LoginEvent{UserID: user.ID, Phone: user.Phone, Method: method, Outcome: types.LoginBlocked})
+		return nil, errAccountBlocked
+	}
+
+	if user.DeletionScheduledAt != nil {
+		cancelled, err := h.store.CancelUserDeletion(user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("cancel user deletion: %w", err)
+		}
+		if cancelled {
+			user.DeletionScheduledAt = nil
+			h.logger.Infow("account deletion cancelled by login", "user_id", user.ID)
+		}
+	}
+
+	deviceName = truncate(deviceName, maxDeviceNameLength)
+
+	session := &types.Session{
+		UserID:     user.ID,
+		DeviceName: deviceName,
+		UserAgent:  r.UserAgent(),
+		IPAddress:  clientIP(r),
+		ExpiresAt:  time.Now().Add(h.tokens.TTL),
+	}
+	if err := h.store.CreateSession(session); err != nil {
+		return nil, err
+	}
+
+	h.recordLogin(r, &types.LoginEvent{UserID: user.ID, Phone: user.Phone, Method: method, Outcome: types.LoginSuccess})
+	return session, nil
+}
+
+// clientIP returns the address of the direct peer without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
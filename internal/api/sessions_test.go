@@ -0,0 +1,35 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"iPhone", 10, "iPhone"},
+		{"iPhone", 6, "iPhone"},
+		{"iPhone", 3, "iPh"},
+		{"گوشی من", 4, "گو"}, // two-byte runes, cut on a boundary
+		{"گوشی من", 5, "گو"}, // cut inside the third rune
+		{"📱 phone", 3, ""},   // cut inside the only leading rune
+		{"a📱", 4, "a"},       // four-byte rune
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.in, tt.max)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+
+	long := strings.Repeat("é", maxDeviceNameLength)
+	if got := truncate(long, maxDeviceNameLength); len(got) > maxDeviceNameLength || !utf8.ValidString(got) {
+		t.Errorf("truncate of %d two-byte runes = %d bytes, valid UTF-8 %t", maxDeviceNameLength, len(got), utf8.ValidString(got))
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/otp"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// StepUpRequestOTP godoc
+// @Summary Request step-up OTP
+// @Description Send an OTP to the current user's phone to re-authenticate before a sensitive operation
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.RequestOTPResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
+// @Router /me/step-up/request-otp [post]
+func (h *Handler) StepUpRequestOTP(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	if err := h.sendOTP(r, principal.Phone, otp.PurposeStepUp); err != nil {
+		if errors.Is(err, errRateLimited) {
+			JSONError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "send step-up otp failed", "user_id", principal.UserID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(dto.RequestOTPResponse{Message: "OTP sent"})
+}
+
+// StepUpVerify godoc
+// @Summary Complete step-up authentication
+// @Description Verify the step-up OTP and reissue the token for the same session with a fresh auth_time, keeping the authentication methods of the login. The token used for the request is revoked.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body dto.StepUpVerifyRequest true "Step-up code"
+// @Success 200 {object} dto.VerifyOTPResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
+// @Router /me/step-up [post]
+func (h *Handler) StepUpVerify(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	var req dto.StepUpVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+	if req.Code == "" {
+		JSONError(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := h.otp.Validate(otp.PurposeStepUp, principal.Phone, req.Code)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "validate step-up otp error", "user_id", principal.UserID)
+		return
+	}
+	if !valid {
+		h.audit(r, types.AuditOTPFailed, principal.UserID, map[string]any{"step_up": true})
+		JSONError(w, "Invalid OTP", http.StatusUnauthorized)
+		return
+	}
+	h.audit(r, types.AuditOTPVerified, principal.UserID, map[string]any{"step_up": true})
+
+	user, err := h.store.GetUserByIDPrimary(principal.UserID)
+	if err != nil {
+		h.JSONErrorWithLog(w, "Database temporarily unavailable. Please try again.", http.StatusInternalServerError, err, "get user by id failed", "user_id", principal.UserID)
+		return
+	}
+
+	// Keep the OIDC scopes granted to the client; permissions are reloaded by issueAccessToken
+	var scopes []string
+	for _, scope := range principal.Scopes {
+		if slices.Contains(supportedScopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	// The methods used at login still apply to the session; step-up adds the OTP just entered
+	amr := slices.Clone(principal.AMR)
+	for _, method := range auth.AMROTP {
+		if !slices.Contains(amr, method) {
+			amr = append(amr, method)
+		}
+	}
+
+	token, err := h.issueAccessToken(r, auth.TokenParams{
+		User:      user,
+		Scopes:    scopes,
+		Audience:  principal.Audience,
+		ClientID:  principal.ClientID,
+		SessionID: principal.SessionID,
+		AMR:       amr,
+	})
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to issue token", http.StatusInternalServerError, err, "issue token failed", "user_id", user.ID)
+		return
+	}
+
+	// Only the reissued token stays valid for the session
+	if claims, ok := accessClaims(r); ok {
+		if err := h.revokeAccessToken(claims); err != nil {
+			h.JSONErrorWithLog(w, "Temporary service issue. Please try again.", http.StatusServiceUnavailable, err, "revoke replaced token failed", "user_id", user.ID, "jti", claims.ID)
+			return
+		}
+	}
+
+	h.logger.Infow("step-up authentication completed", "user_id", user.ID, "session_id", principal.SessionID)
+
+	resp := dto.VerifyOTPResponse{Message: "Step-up success", Token: token}
+	if cookieAuthenticated(r) {
+		csrf, err := h.setSessionCookies(w, token, principal.SessionID)
+		if err != nil {
+			h.JSONErrorWithLog(w, "Failed to issue token", http.StatusInternalServerError, err, "set session cookies failed", "user_id", user.ID)
+			return
+		}
+		resp = dto.VerifyOTPResponse{Message: "Step-up success", CSRFToken: csrf}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
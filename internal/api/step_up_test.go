@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+)
+
+func TestStepUpCodesAreKeptApartFromLoginCodes(t *testing.T) {
+	s := newTestServer(t)
+	token := s.login("+989121234567").Token
+
+	// A login code cannot complete a step-up
+	if rec := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: "+989121234567"}, nil); rec.Code != http.StatusOK {
+		t.Fatalf("request login otp: status %d: %s", rec.Code, rec.Body)
+	}
+	loginCode := s.code("+989121234567")
+	if rec := s.request(http.MethodPost, "/me/step-up", token, dto.StepUpVerifyRequest{Code: loginCode}, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("step-up with a login code: status %d, want 401", rec.Code)
+	}
+
+	// Nor can a step-up code log in
+	if rec := s.request(http.MethodPost, "/me/step-up/request-otp", token, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("request step-up otp: status %d: %s", rec.Code, rec.Body)
+	}
+	stepUpCode := s.stepUpCode("+989121234567")
+	if stepUpCode == "" {
+		t.Fatal("no step-up code was sent")
+	}
+	if stepUpCode != loginCode {
+		if rec := s.request(http.MethodPost, "/verify-otp", "", dto.VerifyOTPRequest{Phone: "+989121234567", Code: stepUpCode}, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("login with a step-up code: status %d, want 401", rec.Code)
+		}
+	}
+	if rec := s.request(http.MethodPost, "/me/step-up", token, dto.StepUpVerifyRequest{Code: stepUpCode}, nil); rec.Code != http.StatusOK {
+		t.Errorf("step-up with its own code: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDeleteMeRequiresStepUpCode(t *testing.T) {
+	s := newTestServer(t)
+	token := s.login("+989121234567").Token
+
+	if rec := s.request(http.MethodPost, "/request-otp", "", dto.RequestOTPRequest{Phone: "+989121234567"}, nil); rec.Code != http.StatusOK {
+		t.Fatalf("request login otp: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := s.request(http.MethodDelete, "/me", token, dto.DeleteAccountRequest{Code: s.code("+989121234567")}, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("deletion with a login code: status %d, want 401", rec.Code)
+	}
+
+	if rec := s.request(http.MethodPost, "/me/step-up/request-otp", token, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("request step-up otp: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := s.request(http.MethodDelete, "/me", token, dto.DeleteAccountRequest{Code: s.stepUpCode("+989121234567")}, nil); rec.Code != http.StatusAccepted {
+		t.Fatalf("deletion with a step-up code: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStepUpKeepsAMRAndRevokesOldToken(t *testing.T) {
+	s := newTestServer(t)
+	login, err := auth.ValidateJWT(s.login("+989121234567").Token, s.handler.tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := login.Principal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.store.GetUserByIDPrimary(principal.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As issued to a user who also entered an authenticator app code
+	old, err := s.handler.issueAccessToken(httptest.NewRequest(http.MethodPost, "/verify-otp/totp", nil), auth.TokenParams{
+		User:      user,
+		Audience:  principal.Audience,
+		SessionID: principal.SessionID,
+		AMR:       auth.AMRTOTP,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := s.request(http.MethodPost, "/me/step-up/request-otp", old, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("request step-up otp: status %d: %s", rec.Code, rec.Body)
+	}
+	rec := s.request(http.MethodPost, "/me/step-up", old, dto.StepUpVerifyRequest{Code: s.stepUpCode("+989121234567")}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("step-up: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp dto.VerifyOTPResponse
+	decode(t, rec, &resp)
+
+	claims, err := auth.ValidateJWT(resp.Token, s.handler.tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{"otp", "sms", "mfa"} {
+		if !slices.Contains(claims.AMR, method) {
+			t.Errorf("amr = %v, missing %s", claims.AMR, method)
+		}
+	}
+	if claims.SessionID != login.SessionID {
+		t.Errorf("sid = %s, want the session of the login %s", claims.SessionID, login.SessionID)
+	}
+
+	if rec := s.request(http.MethodGet, "/me", old, nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /me with the replaced token: status %d, want 401", rec.Code)
+	}
+	if rec := s.request(http.MethodGet, "/me", resp.Token, nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /me with the reissued token: status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxStatusReasonLength bounds the free-text reason stored with a block
+const maxStatusReasonLength = 500
+
+// BlockUser godoc
+// @Summary Block or suspend a user
+// @Description Block a user until unblocked, or suspend them until expires_at (requires users:block). They get no OTP, cannot log in, and their sessions and tokens stop working immediately.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path int true "User ID"
+// @Param body body dto.BlockUserRequest true "Status and reason"
+// @Success 200 {object} types.User
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/{id}/block [post]
+func (h *Handler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if id == principal.UserID {
+		JSONError(w, "Cannot block yourself", http.StatusBadRequest)
+		return
+	}
+
+	var req dto.BlockUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.JSONErrorWithLog(w, "Invalid request body", http.StatusBadRequest, err, "decode request body failed")
+		return
+	}
+
+	status := types.UserStatus{Status: req.Status, StatusReason: strings.TrimSpace(req.Reason), StatusExpiresAt: req.ExpiresAt}
+	if status.Status == "" {
+		status.Status = types.UserStatusBlocked
+	}
+	if status.StatusReason == "" || len(status.StatusReason) > maxStatusReasonLength {
+		JSONError(w, "A reason of at most 500 characters is required", http.StatusBadRequest)
+		return
+	}
+	switch status.Status {
+	case types.UserStatusBlocked:
+		if status.StatusExpiresAt != nil {
+			JSONError(w, "Blocks do not expire; use status suspended for a temporary block", http.StatusBadRequest)
+			return
+		}
+	case types.UserStatusSuspended:
+		if status.StatusExpiresAt == nil || !status.StatusExpiresAt.After(time.Now()) {
+			JSONError(w, "Suspensions require a future expires_at", http.StatusBadRequest)
+			return
+		}
+	default:
+		JSONError(w, "status must be blocked or suspended", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.store.SetUserStatus(id, status)
+	if errors.Is(err, db.ErrNotFound) {
+		JSONError(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to block user", http.StatusInternalServerError, err, "set user status failed", "user_id", id)
+		return
+	}
+
+	h.logger.Infow("user blocked", "user_id", id, "status", status.Status, "expires_at", status.StatusExpiresAt,
+		"by_user_id", principal.UserID, "by_api_key_id", principal.APIKeyID)
+	h.audit(r, types.AuditUserBlocked, id, map[string]any{"status": status.Status, "reason": status.StatusReason, "expires_at": status.StatusExpiresAt})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+// UnblockUser godoc
+// @Summary Unblock a user
+// @Description Lift a block or suspension (requires users:block). The user can request an OTP and log in again.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} types.User
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/{id}/unblock [post]
+func (h *Handler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	principal, _ := GetPrincipalFromContext(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		JSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.store.SetUserStatus(id, types.UserStatus{Status: types.UserStatusActive})
+	if errors.Is(err, db.ErrNotFound) {
+		JSONError(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.JSONErrorWithLog(w, "Failed to unblock user", http.StatusInternalServerError, err, "set user status failed", "user_id", id)
+		return
+	}
+
+	h.logger.Infow("user unblocked", "user_id", id, "by_user_id", principal.UserID, "by_api_key_id", principal.APIKeyID)
+	h.audit(r, types.AuditUserUnblocked, id, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/MiladJlz/dekamond-task/internal/api/dto"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+)
+
+// seedUsers registers n users besides whoever is already there
+func seedUsers(t *testing.T, s *testServer, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, _, err := s.store.UpsertUser(fmt.Sprintf("+98912000%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listUsers(t *testing.T, s *testServer, token string, query url.Values) dto.UserListResponse {
+	t.Helper()
+	rec := s.request(http.MethodGet, "/users?"+query.Encode(), token, nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /users?%s: status %d: %s", query.Encode(), rec.Code, rec.Body)
+	}
+	var page dto.UserListResponse
+	decode(t, rec, &page)
+	return page
+}
+
+func TestGetUsersCursorPagination(t *testing.T) {
+	s := newTestServer(t)
+	token := s.admin()
+	seedUsers(t, s, 6)
+
+	seen := map[uint64]bool{}
+	query := url.Values{"limit": {"3"}}
+	pages := 0
+	for {
+		page := listUsers(t, s, token, query)
+		pages++
+		if page.Total != 7 {
+			t.Fatalf("total = %d, want 7", page.Total)
+		}
+		for _, u := range page.Users {
+			if seen[u.ID] {
+				t.Fatalf("user %d returned twice", u.ID)
+			}
+			seen[u.ID] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	if len(seen) != 7 || pages != 3 {
+		t.Errorf("got %d users in %d pages, want 7 in 3", len(seen), pages)
+	}
+}
+
+func TestGetUsersOffsetPagination(t *testing.T) {
+	s := newTestServer(t)
+	token := s.admin()
+	seedUsers(t, s, 4)
+
+	all := listUsers(t, s, token, url.Values{"sort": {"id:asc"}})
+	page := listUsers(t, s, token, url.Values{"sort": {"id:asc"}, "limit": {"2"}, "offset": {"2"}})
+	if len(page.Users) != 2 || page.Users[0].ID != all.Users[2].ID || page.Users[1].ID != all.Users[3].ID {
+		t.Errorf("offset page = %v, want users 3 and 4 of %v", page.Users, all.Users)
+	}
+	if page.Offset != 2 || page.Limit != 2 {
+		t.Errorf("offset, limit = %d, %d, want 2, 2", page.Offset, page.Limit)
+	}
+}
+
+func TestGetUsersRejectsBadPaging(t *testing.T) {
+	s := newTestServer(t)
+	token := s.admin()
+
+	// forged is a well-formed cursor whose value does not have the sort field's type
+	forged := func(sort, value string) string {
+		parsed, err := parseUserSort(sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "sort=" + sort + "&cursor=" + encodeUserCursor(parsed, db.UserCursor{Value: value, ID: 1})
+	}
+	for _, query := range []string{
+		"cursor=bogus",
+		"cursor=MTcyNDA2ODgwMDAwMDAwMDox&offset=1",
+		"sort=password",
+		forged("created_at:desc", "yesterday"),
+		forged("last_login_at:asc", "infinity"),
+		forged("id:asc", "1"),
+	} {
+		if rec := s.request(http.MethodGet, "/users?"+query, token, nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /users?%s: status %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestGetUsersRequiresPermission(t *testing.T) {
+	s := newTestServer(t)
+	token := s.login("+989121234567").Token
+
+	if rec := s.request(http.MethodGet, "/users", token, nil, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", rec.Code)
+	}
+}
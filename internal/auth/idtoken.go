@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is the RSA key used to sign OpenID Connect ID tokens
+type SigningKey struct {
+	Key   *rsa.PrivateKey
+	KeyID string
+}
+
+// JWK is the public part of a signing key in RFC 7517 format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadSigningKey reads a PEM encoded RSA private key (PKCS#1 or PKCS#8) from path
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return newSigningKey(key), nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return newSigningKey(key), nil
+}
+
+// GenerateSigningKey creates an ephemeral RSA key; tokens signed with it do not survive restarts
+func GenerateSigningKey() (*SigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(key), nil
+}
+
+func newSigningKey(key *rsa.PrivateKey) *SigningKey {
+	n := base64URL(key.N.Bytes())
+	e := base64URL(big.NewInt(int64(key.E)).Bytes())
+
+	// RFC 7638 thumbprint: SHA-256 of the required members in lexicographic order
+	thumbprint, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{E: e, Kty: "RSA", N: n})
+	sum := sha256.Sum256(thumbprint)
+
+	return &SigningKey{Key: key, KeyID: base64URL(sum[:])}
+}
+
+// JWKS returns the public key set published at the jwks_uri
+func (k *SigningKey) JWKS() JWKS {
+	return JWKS{Keys: []JWK{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		KeyID:     k.KeyID,
+		N:         base64URL(k.Key.N.Bytes()),
+		E:         base64URL(big.NewInt(int64(k.Key.E)).Bytes()),
+	}}}
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token
+type IDTokenClaims struct {
+	Nonce               string           `json:"nonce,omitempty"`
+	AuthTime            *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR                 []string         `json:"amr,omitempty"`
+	PhoneNumber         string           `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool             `json:"phone_number_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IDTokenParams describes the login an ID token is issued for
+type IDTokenParams struct {
+	Issuer   string
+	ClientID string
+	Nonce    string
+	AuthTime time.Time
+	AMR      []string
+	// IncludePhone adds the phone_number claims when the phone scope was granted
+	IncludePhone bool
+	TTL          time.Duration
+}
+
+// GenerateIDToken mints an RS256 ID token for user addressed to the client
+func GenerateIDToken(user *types.User, params IDTokenParams, key *SigningKey) (string, error) {
+	now := time.Now()
+	claims := IDTokenClaims{
+		Nonce:    params.Nonce,
+		AuthTime: jwt.NewNumericDate(params.AuthTime),
+		AMR:      params.AMR,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(params.TTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    params.Issuer,
+			Subject:   strconv.FormatUint(user.ID, 10),
+			Audience:  jwt.ClaimStrings{params.ClientID},
+		},
+	}
+	if params.IncludePhone {
+		claims.PhoneNumber = user.Phone
+		claims.PhoneNumberVerified = true
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.KeyID
+	return token.SignedString(key.Key)
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
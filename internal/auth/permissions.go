@@ -0,0 +1,37 @@
+package auth
+
+// Permissions checked by the API; they are granted to roles in the role_permissions table
+// and carried in the token scope claim.
+const (
+	PermissionUsersList    = "users:list"
+	PermissionUsersRead    = "users:read"
+	PermissionRolesWrite   = "roles:write"
+	PermissionClientsWrite = "clients:write"
+	PermissionAPIKeysWrite = "api_keys:write"
+	// PermissionUsersImpersonate lets support staff mint tokens acting as another user
+	PermissionUsersImpersonate = "users:impersonate"
+	// PermissionUsersBlock lets support staff block, suspend and unblock users
+	PermissionUsersBlock = "users:block"
+	// PermissionAuditRead lets security reviewers read the audit log
+	PermissionAuditRead = "audit:read"
+	// PermissionUsersExport lets analysts download every user matching a listing filter
+	PermissionUsersExport = "users:export"
+	// PermissionUsersImport lets operators create users in bulk, e.g. when migrating from another system
+	PermissionUsersImport = "users:import"
+)
+
+// AllPermissions lists every permission above. The migrations grant all of them to the admin
+// role, and the in-memory store does the same from this list, so a new permission is added here
+// and in a migration.
+var AllPermissions = []string{
+	PermissionUsersList,
+	PermissionUsersRead,
+	PermissionRolesWrite,
+	PermissionClientsWrite,
+	PermissionAPIKeysWrite,
+	PermissionUsersImpersonate,
+	PermissionUsersBlock,
+	PermissionAuditRead,
+	PermissionUsersExport,
+	PermissionUsersImport,
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Principal is the authenticated caller attached to a request context
+type Principal struct {
+	UserID uint64
+	Phone  string
+	Roles  []string
+	Scopes []string
+	// SessionID is the login session the token belongs to; 0 for tokens without one
+	SessionID uint64
+	// APIKeyID is set instead of UserID when a service authenticated with an API key
+	APIKeyID uint64
+	ClientID string
+	Audience []string
+	// AuthTime is when the user last proved possession of their phone; zero for API keys
+	AuthTime time.Time
+	AMR      []string
+	// ActorID is the staff member impersonating the user; 0 for the user's own tokens
+	ActorID uint64
+}
+
+// HasRole reports whether the principal was granted the given role
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// HasScope reports whether the principal was granted the given scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Impersonated reports whether the token was issued to a staff member acting as the user
+func (p *Principal) Impersonated() bool {
+	return p.ActorID != 0
+}
+
+// AuthenticatedWithin reports whether the user authenticated no longer than maxAge ago
+func (p *Principal) AuthenticatedWithin(maxAge time.Duration) bool {
+	return !p.AuthTime.IsZero() && time.Since(p.AuthTime) <= maxAge
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored in ctx, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "testing"
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 Appendix B
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"S256", verifier, challenge, true},
+		{"wrong verifier", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXK", challenge, false},
+		{"empty verifier", "", challenge, false},
+		{"plain method", verifier, verifier, false},
+		{"challenge as verifier", challenge, challenge, false},
+		{"padded challenge", verifier, challenge + "=", false},
+		{"empty challenge", verifier, "", false},
+	}
+	for _, tt := range tests {
+		if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+			t.Errorf("%s: VerifyPKCE = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
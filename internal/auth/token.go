@@ -1,48 +1,218 @@
 package auth
 
 import (
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/MiladJlz/dekamond-task/internal/types"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// ErrUnknownClient is returned when a token is requested for an unregistered client application
+var ErrUnknownClient = errors.New("unknown client")
+
+// RFC 8176 authentication method references for the supported logins
+var (
+	// AMROTP is an SMS one-time password
+	AMROTP = []string{"otp", "sms"}
+	// AMRTOTP is an SMS one-time password followed by an authenticator app code
+	AMRTOTP = []string{"otp", "sms", "mfa"}
+	// AMRPasskey is a user-verified WebAuthn assertion: proof of possession of a key plus a PIN or biometric
+	AMRPasskey = []string{"pop", "mfa"}
+)
+
 type Claims struct {
-	Phone string `json:"phone"`
+	Phone string   `json:"phone"`
+	Roles []string `json:"roles,omitempty"`
+	// Scope is a space-delimited list of permissions, as in RFC 8693
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the OIDC client the token was issued to, as in RFC 9068
+	ClientID string `json:"client_id,omitempty"`
+	// SessionID binds the token to the login session it was issued for
+	SessionID string `json:"sid,omitempty"`
+	// AuthTime is when the user last actively authenticated, refreshed by step-up
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// AMR lists the RFC 8176 methods used for that authentication
+	AMR []string `json:"amr,omitempty"`
+	// Act is set on impersonation tokens and identifies the staff member acting as the subject
+	Act *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(phone string, secret string) (string, error) {
+// Actor is the RFC 8693 actor claim
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// Principal builds the authenticated identity described by the claims
+func (c *Claims) Principal() (*Principal, error) {
+	userID, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject: %w", err)
+	}
+	var sessionID uint64
+	if c.SessionID != "" {
+		if sessionID, err = strconv.ParseUint(c.SessionID, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid session id: %w", err)
+		}
+	}
+	principal := &Principal{
+		UserID:    userID,
+		Phone:     c.Phone,
+		Roles:     c.Roles,
+		Scopes:    strings.Fields(c.Scope),
+		SessionID: sessionID,
+		ClientID:  c.ClientID,
+		Audience:  c.Audience,
+		AMR:       c.AMR,
+	}
+	if c.AuthTime != nil {
+		principal.AuthTime = c.AuthTime.Time
+	}
+	if c.Act != nil {
+		if principal.ActorID, err = strconv.ParseUint(c.Act.Subject, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid actor: %w", err)
+		}
+	}
+	return principal, nil
+}
+
+// TokenConfig controls how tokens are minted and which tokens are accepted
+type TokenConfig struct {
+	Secret string
+	Issuer string
+	// Audiences are accepted on validation; the first one is the default when minting
+	Audiences []string
+	// ClientAudiences lists the audiences minted for each client application
+	ClientAudiences map[string][]string
+	TTL             time.Duration
+	// ImpersonationTTL is the lifetime of tokens minted for support staff acting as a user
+	ImpersonationTTL time.Duration
+	Leeway           time.Duration
+}
+
+// AudienceFor returns the audiences to mint for a client; an empty client ID gets the default audience
+func (c TokenConfig) AudienceFor(clientID string) ([]string, error) {
+	if clientID == "" {
+		if len(c.Audiences) == 0 {
+			return nil, nil
+		}
+		return c.Audiences[:1], nil
+	}
+	audiences, ok := c.ClientAudiences[clientID]
+	if !ok {
+		return nil, ErrUnknownClient
+	}
+	return audiences, nil
+}
+
+// TokenParams describes who an access token is issued to and what it grants
+type TokenParams struct {
+	User      *types.User
+	Roles     []string
+	Scopes    []string
+	Audience  []string
+	ClientID  string
+	SessionID uint64
+	// AuthTime defaults to now, i.e. the token is issued right after the user authenticated
+	AuthTime time.Time
+	AMR      []string
+	// ID is the jti; a random one is generated when empty
+	ID string
+	// ActorID marks an impersonation token issued to that staff member
+	ActorID uint64
+	// TTL overrides the configured token lifetime
+	TTL time.Duration
+}
+
+func GenerateJWT(params TokenParams, cfg TokenConfig) (string, error) {
+	tokenID := params.ID
+	if tokenID == "" {
+		var err error
+		if tokenID, err = NewTokenID(); err != nil {
+			return "", err
+		}
+	}
+
+	var sessionID string
+	if params.SessionID != 0 {
+		sessionID = strconv.FormatUint(params.SessionID, 10)
+	}
+
+	ttl := params.TTL
+	if ttl == 0 {
+		ttl = cfg.TTL
+	}
+
+	now := time.Now()
+	authTime := params.AuthTime
+	if authTime.IsZero() {
+		authTime = now
+	}
+
 	claims := Claims{
-		Phone: phone,
+		Phone:     params.User.Phone,
+		Roles:     params.Roles,
+		Scope:     strings.Join(params.Scopes, " "),
+		ClientID:  params.ClientID,
+		SessionID: sessionID,
+		AuthTime:  jwt.NewNumericDate(authTime),
+		AMR:       params.AMR,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "otp-auth-service",
-			Subject:   phone,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    cfg.Issuer,
+			Subject:   strconv.FormatUint(params.User.ID, 10),
+			Audience:  params.Audience,
+			ID:        tokenID,
 		},
 	}
 
+	if params.ActorID != 0 {
+		claims.Act = &Actor{Subject: strconv.FormatUint(params.ActorID, 10)}
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return token.SignedString([]byte(cfg.Secret))
 }
 
-func ValidateJWT(tokenString string, secret string) (string, error) {
+// ValidateJWT checks signature, issuer, audience and lifetime. A config without
+// audiences skips the audience check, which introspection relies on.
+func ValidateJWT(tokenString string, cfg TokenConfig) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secret), nil
-	})
+		return []byte(cfg.Secret), nil
+	},
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audiences...),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.Phone, nil
+		return claims, nil
 	}
 
-	return "", fmt.Errorf("invalid token")
+	return nil, fmt.Errorf("invalid token")
+}
+
+// NewTokenID returns a random jti used to revoke individual tokens
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64URL(b), nil
 }
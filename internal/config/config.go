@@ -1,8 +1,14 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -10,32 +16,172 @@ import (
 )
 
 type Config struct {
-	AppPort         string
-	PostgresDSN     string
+	AppPort string
+	// DatabaseDriver selects the storage: postgres, or memory for local development without a database
+	DatabaseDriver string
+	PostgresDSN    string
+	// PostgresReplicaDSNs are read replicas serving user reads that tolerate replication lag
+	PostgresReplicaDSNs   []string
+	ReplicaHealthInterval time.Duration
+	// ReplicaMaxLag takes a replica out of rotation when it falls further behind; 0 accepts any lag
+	ReplicaMaxLag   time.Duration
 	RedisAddr       string
 	JWTSecret       string
 	OTPTTL          time.Duration
 	RateLimit       int
 	RateLimitWindow time.Duration
+
+	JWTIssuer    string
+	JWTAudiences []string
+	// JWTClientAudiences maps a client application ID to the audiences its tokens are minted for
+	JWTClientAudiences map[string][]string
+	JWTTTL             time.Duration
+	JWTLeeway          time.Duration
+	// StepUpMaxAge is how recent the last OTP must be for sensitive operations
+	StepUpMaxAge time.Duration
+	// ImpersonationTTL is the lifetime of support impersonation tokens
+	ImpersonationTTL time.Duration
+
+	// OIDCIssuerURL is the public base URL of the OIDC provider, including the API version prefix
+	OIDCIssuerURL      string
+	OIDCSigningKeyFile string
+	OIDCCodeTTL        time.Duration
+	OIDCLoginTTL       time.Duration
+
+	// TOTPEncryptionKey encrypts authenticator secrets at rest (32 bytes)
+	TOTPEncryptionKey []byte
+	TOTPIssuer        string
+	MFAChallengeTTL   time.Duration
+
+	// WebAuthnRPID is the domain passkeys are bound to; it must match the browser origins' host
+	WebAuthnRPID         string
+	WebAuthnRPName       string
+	WebAuthnOrigins      []string
+	WebAuthnChallengeTTL time.Duration
+
+	// SessionCookieClients lists client IDs that receive the token in HttpOnly cookies instead of the response body
+	SessionCookieClients  []string
+	SessionCookieDomain   string
+	SessionCookieSecure   bool
+	SessionCookieSameSite http.SameSite
+
+	// AccountDeletionGracePeriod is how long a deleted account can still be restored by logging in
+	AccountDeletionGracePeriod time.Duration
+	// AccountDeletionAnonymize keeps purged user rows with personal data scrubbed instead of deleting them
+	AccountDeletionAnonymize bool
+	AccountPurgeInterval     time.Duration
+
+	// AuditPhoneKey keys the hashes that stand in for unknown phone numbers in the audit log (32
+	// bytes); without one they are left out
+	AuditPhoneKey []byte
+
+	// PhoneCountryCode is given to phone numbers entered without a calling code, digits only;
+	// when empty such numbers are rejected
+	PhoneCountryCode string
+
+	// ExportDir holds the files of background user exports until ExportRetention has passed
+	ExportDir        string
+	ExportRetention  time.Duration
+	ExportMaxRunning int
+
+	// ImportMaxBytes bounds the body of a user import request; the import command has no limit
+	ImportMaxBytes  int
+	ImportBatchSize int
+
+	// MigrateOnStartup applies pending schema migrations before the server starts
+	MigrateOnStartup bool
 }
 
 func LoadConfig(logger *zap.Logger) *Config {
-	if err := godotenv.Load("../../.env"); err != nil {
-		logger.Info(".env not loaded; relying on environment variables", zap.Error(err))
-	}
+	loadDotEnv(logger)
 	cfg := &Config{
 		AppPort:         mustEnv("APP_PORT", logger),
-		PostgresDSN:     mustEnv("POSTGRES_DSN", logger),
+		DatabaseDriver:  envOrDefault("DATABASE_DRIVER", "postgres"),
 		RedisAddr:       mustEnv("REDIS_ADDR", logger),
 		JWTSecret:       mustEnv("JWT_SECRET", logger),
 		OTPTTL:          mustDurationEnv("OTP_TTL", logger),
 		RateLimit:       mustIntEnv("RATE_LIMIT", logger),
 		RateLimitWindow: mustDurationEnv("RATE_LIMIT_WINDOW", logger),
+
+		JWTIssuer:          envOrDefault("JWT_ISSUER", "otp-auth-service"),
+		JWTAudiences:       listEnvOrDefault("JWT_AUDIENCES", []string{"otp-auth-api"}),
+		JWTClientAudiences: clientAudiencesEnv("JWT_CLIENT_AUDIENCES", logger),
+		JWTTTL:             durationEnvOrDefault("JWT_TTL", 24*time.Hour, logger),
+		JWTLeeway:          durationEnvOrDefault("JWT_LEEWAY", 30*time.Second, logger),
+		StepUpMaxAge:       durationEnvOrDefault("STEP_UP_MAX_AGE", 5*time.Minute, logger),
+		ImpersonationTTL:   durationEnvOrDefault("IMPERSONATION_TTL", 15*time.Minute, logger),
+
+		OIDCIssuerURL:      strings.TrimSuffix(envOrDefault("OIDC_ISSUER_URL", "http://localhost:8080/v1"), "/"),
+		OIDCSigningKeyFile: os.Getenv("OIDC_SIGNING_KEY_FILE"),
+		OIDCCodeTTL:        durationEnvOrDefault("OIDC_CODE_TTL", time.Minute, logger),
+		OIDCLoginTTL:       durationEnvOrDefault("OIDC_LOGIN_TTL", 10*time.Minute, logger),
+
+		TOTPIssuer:      envOrDefault("TOTP_ISSUER", "Dekamond"),
+		MFAChallengeTTL: durationEnvOrDefault("MFA_CHALLENGE_TTL", 5*time.Minute, logger),
+
+		WebAuthnRPID:         envOrDefault("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:       envOrDefault("WEBAUTHN_RP_NAME", "Dekamond"),
+		WebAuthnOrigins:      listEnvOrDefault("WEBAUTHN_ORIGINS", []string{"http://localhost:8080"}),
+		WebAuthnChallengeTTL: durationEnvOrDefault("WEBAUTHN_CHALLENGE_TTL", 5*time.Minute, logger),
+
+		SessionCookieClients:  listEnvOrDefault("SESSION_COOKIE_CLIENTS", nil),
+		SessionCookieDomain:   os.Getenv("SESSION_COOKIE_DOMAIN"),
+		SessionCookieSecure:   boolEnvOrDefault("SESSION_COOKIE_SECURE", true, logger),
+		SessionCookieSameSite: sameSiteEnv("SESSION_COOKIE_SAMESITE", logger),
+
+		AccountDeletionGracePeriod: durationEnvOrDefault("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour, logger),
+		AccountDeletionAnonymize:   boolEnvOrDefault("ACCOUNT_DELETION_ANONYMIZE", false, logger),
+		AccountPurgeInterval:       durationEnvOrDefault("ACCOUNT_PURGE_INTERVAL", time.Hour, logger),
+
+		AuditPhoneKey:    auditPhoneKeyEnv("AUDIT_PHONE_KEY", logger),
+		PhoneCountryCode: phoneCountryCodeEnv("PHONE_COUNTRY_CODE", logger),
+
+		ExportDir:        envOrDefault("EXPORT_DIR", filepath.Join(os.TempDir(), "user-exports")),
+		ExportRetention:  durationEnvOrDefault("EXPORT_RETENTION", 24*time.Hour, logger),
+		ExportMaxRunning: intEnvOrDefault("EXPORT_MAX_RUNNING", 2, logger),
+
+		ImportMaxBytes:  intEnvOrDefault("IMPORT_MAX_BYTES", 64<<20, logger),
+		ImportBatchSize: intEnvOrDefault("IMPORT_BATCH_SIZE", 1000, logger),
+
+		MigrateOnStartup: boolEnvOrDefault("MIGRATE_ON_STARTUP", false, logger),
+	}
+	cfg.TOTPEncryptionKey = totpKeyEnv("TOTP_ENCRYPTION_KEY", cfg.JWTSecret, logger)
+
+	switch cfg.DatabaseDriver {
+	case "postgres":
+		cfg.PostgresDSN = mustEnv("POSTGRES_DSN", logger)
+		cfg.PostgresReplicaDSNs = listEnvOrDefault("POSTGRES_REPLICA_DSNS", nil)
+		cfg.ReplicaHealthInterval = durationEnvOrDefault("REPLICA_HEALTH_INTERVAL", 5*time.Second, logger)
+		cfg.ReplicaMaxLag = durationEnvOrDefault("REPLICA_MAX_LAG", 30*time.Second, logger)
+	case "memory":
+	default:
+		logger.Fatal("invalid database driver",
+			zap.String("key", "DATABASE_DRIVER"),
+			zap.String("value", cfg.DatabaseDriver),
+			zap.String("expected", "postgres or memory"))
 	}
 
 	return cfg
 }
 
+// LoadPostgresDSN loads only the database connection string, for commands that do not start the server
+func LoadPostgresDSN(logger *zap.Logger) string {
+	loadDotEnv(logger)
+	return mustEnv("POSTGRES_DSN", logger)
+}
+
+// LoadPhoneCountryCode reads PHONE_COUNTRY_CODE for commands that do not need the full config
+func LoadPhoneCountryCode(logger *zap.Logger) string {
+	loadDotEnv(logger)
+	return phoneCountryCodeEnv("PHONE_COUNTRY_CODE", logger)
+}
+
+func loadDotEnv(logger *zap.Logger) {
+	if err := godotenv.Load("../../.env"); err != nil {
+		logger.Info(".env not loaded; relying on environment variables", zap.Error(err))
+	}
+}
+
 func mustEnv(key string, logger *zap.Logger) string {
 	v := os.Getenv(key)
 	if v == "" {
@@ -74,3 +220,149 @@ func mustIntEnv(key string, logger *zap.Logger) int {
 	}
 	return value
 }
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func durationEnvOrDefault(key string, fallback time.Duration, logger *zap.Logger) time.Duration {
+	if os.Getenv(key) == "" {
+		return fallback
+	}
+	return mustDurationEnv(key, logger)
+}
+
+func intEnvOrDefault(key string, fallback int, logger *zap.Logger) int {
+	if os.Getenv(key) == "" {
+		return fallback
+	}
+	return mustIntEnv(key, logger)
+}
+
+func boolEnvOrDefault(key string, fallback bool, logger *zap.Logger) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	value, err := strconv.ParseBool(v)
+	if err != nil {
+		logger.Fatal("invalid boolean format",
+			zap.String("key", key),
+			zap.String("value", v))
+	}
+	return value
+}
+
+// sameSiteEnv parses a cookie SameSite mode, defaulting to lax
+func sameSiteEnv(key string, logger *zap.Logger) http.SameSite {
+	switch v := strings.ToLower(os.Getenv(key)); v {
+	case "", "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		logger.Fatal("invalid SameSite mode",
+			zap.String("key", key),
+			zap.String("value", v),
+			zap.String("expected_format", "use strict, lax or none"))
+		return http.SameSiteDefaultMode
+	}
+}
+
+var countryCodePattern = regexp.MustCompile(`^\+?[1-9][0-9]{0,2}$`)
+
+// phoneCountryCodeEnv reads an ITU calling code such as 98 or +98, returned without the +
+func phoneCountryCodeEnv(key string, logger *zap.Logger) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return ""
+	}
+	if !countryCodePattern.MatchString(v) {
+		logger.Fatal("invalid country calling code",
+			zap.String("key", key),
+			zap.String("value", v),
+			zap.String("expected_format", "digits such as 98, optionally with a leading +"))
+	}
+	return strings.TrimPrefix(v, "+")
+}
+
+// listEnvOrDefault parses a comma-separated list, ignoring empty entries
+func listEnvOrDefault(key string, fallback []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	var values []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
+
+// clientAudiencesEnv parses entries like "web:api|payments,partner:partner-api"
+func clientAudiencesEnv(key string, logger *zap.Logger) map[string][]string {
+	clients := map[string][]string{}
+	for _, entry := range listEnvOrDefault(key, nil) {
+		clientID, audiences, ok := strings.Cut(entry, ":")
+		clientID = strings.TrimSpace(clientID)
+		if !ok || clientID == "" {
+			logger.Fatal("invalid client audience format",
+				zap.String("key", key),
+				zap.String("value", entry),
+				zap.String("expected_format", "use format like web:api|payments,partner:partner-api"))
+		}
+
+		for _, aud := range strings.Split(audiences, "|") {
+			if aud = strings.TrimSpace(aud); aud != "" {
+				clients[clientID] = append(clients[clientID], aud)
+			}
+		}
+		if len(clients[clientID]) == 0 {
+			logger.Fatal("client has no audiences", zap.String("key", key), zap.String("client_id", clientID))
+		}
+	}
+	return clients
+}
+
+// totpKeyEnv decodes a base64 32-byte key; without one it derives a key from the JWT secret
+func totpKeyEnv(key, jwtSecret string, logger *zap.Logger) []byte {
+	v := os.Getenv(key)
+	if v == "" {
+		logger.Warn("TOTP_ENCRYPTION_KEY not set; deriving it from JWT_SECRET, rotating the JWT secret will break enrolled authenticators")
+		sum := sha256.Sum256([]byte("totp-encryption:" + jwtSecret))
+		return sum[:]
+	}
+	return decodeKey(key, v, logger)
+}
+
+// auditPhoneKeyEnv decodes a base64 32-byte key, or returns nil if it is not set
+func auditPhoneKeyEnv(key string, logger *zap.Logger) []byte {
+	v := os.Getenv(key)
+	if v == "" {
+		logger.Warn("AUDIT_PHONE_KEY not set; audit entries about unknown phone numbers will not record phone_hash")
+		return nil
+	}
+	return decodeKey(key, v, logger)
+}
+
+func decodeKey(key, v string, logger *zap.Logger) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(decoded) != 32 {
+		logger.Fatal("invalid key",
+			zap.String("key", key),
+			zap.String("expected_format", "base64 encoded 32 bytes, e.g. openssl rand -base64 32"))
+	}
+	return decoded
+}
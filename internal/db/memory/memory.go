@@ -0,0 +1,484 @@
+// Package memory implements db.UserRepository in process memory, for handler tests and running
+// the server locally without Postgres. Data is lost when the process exits.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// Store keeps every table in maps guarded by one mutex. It returns copies, so callers cannot
+// change stored rows by accident.
+type Store struct {
+	mu sync.Mutex
+
+	users           map[uint64]*types.User
+	rolePermissions map[string][]string
+	userRoles       map[uint64]map[string]bool
+	clients         map[string]*types.OAuthClient
+	sessions        map[uint64]*session
+	apiKeys         map[uint64]*types.APIKey
+	totp            map[uint64]*types.TOTPEnrollment
+	credentials     map[uint64]*types.WebAuthnCredential
+	impersonations  []types.ImpersonationEvent
+	logins          []types.LoginEvent
+	audit           []types.AuditEntry
+
+	// lastID holds the last identifier handed out per table, like a BIGSERIAL sequence
+	lastID map[string]uint64
+}
+
+// session is a stored session with the revocation time the API never exposes
+type session struct {
+	types.Session
+	revokedAt *time.Time
+}
+
+var _ db.UserRepository = (*Store)(nil)
+
+// New returns an empty store with the admin role granted every permission, as the migrations seed it
+func New() *Store {
+	return &Store{
+		users: map[uint64]*types.User{},
+		rolePermissions: map[string][]string{
+			"admin": slices.Clone(auth.AllPermissions),
+		},
+		userRoles:   map[uint64]map[string]bool{},
+		clients:     map[string]*types.OAuthClient{},
+		sessions:    map[uint64]*session{},
+		apiKeys:     map[uint64]*types.APIKey{},
+		totp:        map[uint64]*types.TOTPEnrollment{},
+		credentials: map[uint64]*types.WebAuthnCredential{},
+		lastID:      map[string]uint64{},
+	}
+}
+
+// now returns the current time at the precision Postgres stores
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (s *Store) nextID(table string) uint64 {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// Ping always succeeds; the store lives in the process
+func (s *Store) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Replicas returns nothing; the memory store has no replicas
+func (s *Store) Replicas() []db.ReplicaStatus {
+	return nil
+}
+
+// readUser returns a copy of u with an ended suspension reading as active, like db.Store
+func readUser(u *types.User) *types.User {
+	user := *u
+	if !user.Restricted(time.Now()) {
+		user.UserStatus = types.UserStatus{Status: types.UserStatusActive}
+	}
+	return &user
+}
+
+func (s *Store) userByPhone(phone string) *types.User {
+	for _, u := range s.users {
+		if u.Phone == phone {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *Store) UpsertUser(phone string) (*types.User, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u := s.userByPhone(phone); u != nil {
+		return readUser(u), false, nil
+	}
+	t := now()
+	id := s.nextID("users")
+	u := &types.User{ID: id, Phone: phone, UserStatus: types.UserStatus{Status: types.UserStatusActive}, CreatedAt: t, UpdatedAt: t}
+	s.users[id] = u
+	return readUser(u), true, nil
+}
+
+func (s *Store) ImportUsers(users []db.ImportUser) (map[string]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := map[string]uint64{}
+	for _, imported := range users {
+		if _, ok := created[imported.Phone]; ok || s.userByPhone(imported.Phone) != nil {
+			continue
+		}
+		t := now()
+		createdAt := imported.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = t
+		}
+		id := s.nextID("users")
+		s.users[id] = &types.User{
+			ID:          id,
+			Phone:       imported.Phone,
+			UserProfile: imported.Profile,
+			UserStatus:  types.UserStatus{Status: types.UserStatusActive},
+			CreatedAt:   createdAt,
+			UpdatedAt:   t,
+		}
+		created[imported.Phone] = id
+	}
+	return created, nil
+}
+
+func (s *Store) GetUserByID(id uint64) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return readUser(u), nil
+}
+
+func (s *Store) GetUserByIDPrimary(id uint64) (*types.User, error) {
+	return s.GetUserByID(id)
+}
+
+func (s *Store) GetUserByPhone(phone string) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByPhone(phone)
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	return readUser(u), nil
+}
+
+func (s *Store) GetUsers(opts db.UserListOptions) ([]types.User, error) {
+	sort := opts.Sort
+	if sort.Field == "" {
+		sort = db.DefaultUserSort
+	}
+	if !db.ValidUserSortField(sort.Field) {
+		return nil, fmt.Errorf("unsupported sort field %q", sort.Field)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matched := s.filterUsers(opts.UserFilter)
+	slices.SortFunc(matched, func(a, b types.User) int {
+		c := sort.Compare(sort.CursorFor(&a), sort.CursorFor(&b))
+		if sort.Desc {
+			return -c
+		}
+		return c
+	})
+
+	var users []types.User
+	skipped := 0
+	for _, u := range matched {
+		if opts.After != nil {
+			c := sort.Compare(sort.CursorFor(&u), *opts.After)
+			if (sort.Desc && c >= 0) || (!sort.Desc && c <= 0) {
+				continue
+			}
+		} else if skipped < opts.Offset {
+			skipped++
+			continue
+		}
+		if len(users) == opts.Limit {
+			break
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// ExportUsers hands fn a snapshot of the matching users, taken before the first call
+func (s *Store) ExportUsers(ctx context.Context, filter db.UserFilter, sort db.UserSort, fn func(*types.User) error) error {
+	// A negative limit is never reached, so every match is returned
+	users, err := s.GetUsers(db.UserListOptions{UserFilter: filter, Sort: sort, Limit: -1})
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetUsersCount(filter db.UserFilter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.filterUsers(filter)), nil
+}
+
+func (s *Store) filterUsers(filter db.UserFilter) []types.User {
+	var users []types.User
+	for _, u := range s.users {
+		if user := readUser(u); filter.Matches(user) {
+			users = append(users, *user)
+		}
+	}
+	return users
+}
+
+func (s *Store) UpdateUserProfile(id uint64, profile types.UserProfile, lastUpdatedAt time.Time) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok || !u.UpdatedAt.Equal(lastUpdatedAt) {
+		return nil, db.ErrConflict
+	}
+	u.UserProfile = profile
+	u.UpdatedAt = now()
+	return readUser(u), nil
+}
+
+func (s *Store) SetUserStatus(id uint64, status types.UserStatus) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok || u.DeletedAt != nil {
+		return nil, db.ErrNotFound
+	}
+	u.UserStatus = status
+	if status.Status != types.UserStatusActive {
+		s.revokeSessions(id)
+	}
+	return readUser(u), nil
+}
+
+func (s *Store) UserRestricted(id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok || u.DeletedAt != nil {
+		return true, nil
+	}
+	return u.Restricted(time.Now()), nil
+}
+
+func (s *Store) ScheduleUserDeletion(id uint64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[id]; ok {
+		u.DeletionScheduledAt = &at
+	}
+	s.revokeSessions(id)
+	return nil
+}
+
+func (s *Store) CancelUserDeletion(id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok || u.DeletionScheduledAt == nil {
+		return false, nil
+	}
+	u.DeletionScheduledAt = nil
+	return true, nil
+}
+
+// dueDeletions returns up to limit users whose deletion is due, the earliest scheduled first
+func (s *Store) dueDeletions(limit int) []*types.User {
+	t := time.Now()
+	var due []*types.User
+	for _, u := range s.users {
+		if u.DeletionScheduledAt != nil && !u.DeletionScheduledAt.After(t) {
+			due = append(due, u)
+		}
+	}
+	slices.SortFunc(due, func(a, b *types.User) int { return a.DeletionScheduledAt.Compare(*b.DeletionScheduledAt) })
+	return due[:min(limit, len(due))]
+}
+
+func (s *Store) PurgeDeletedUsers(limit int) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []uint64{}
+	for _, u := range s.dueDeletions(limit) {
+		ids = append(ids, u.ID)
+		delete(s.users, u.ID)
+		s.deleteUserData(u.ID)
+
+		// Foreign keys declared ON DELETE SET NULL
+		for _, key := range s.apiKeys {
+			if key.CreatedBy == u.ID {
+				key.CreatedBy = 0
+			}
+		}
+		for i := range s.impersonations {
+			if s.impersonations[i].ActorID == u.ID {
+				s.impersonations[i].ActorID = 0
+			}
+			if s.impersonations[i].TargetID == u.ID {
+				s.impersonations[i].TargetID = 0
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (s *Store) AnonymizeDeletedUsers(limit int) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []uint64{}
+	t := now()
+	for _, u := range s.dueDeletions(limit) {
+		ids = append(ids, u.ID)
+		u.Phone = fmt.Sprintf("deleted:%d", u.ID)
+		u.UserProfile = types.UserProfile{}
+		u.DeletionScheduledAt = nil
+		u.DeletedAt = &t
+		u.UpdatedAt = t
+		s.deleteUserData(u.ID)
+	}
+	return ids, nil
+}
+
+// deleteUserData removes the rows that reference the user and cascade in Postgres
+func (s *Store) deleteUserData(userID uint64) {
+	delete(s.userRoles, userID)
+	delete(s.totp, userID)
+	maps.DeleteFunc(s.sessions, func(_ uint64, sess *session) bool { return sess.UserID == userID })
+	maps.DeleteFunc(s.credentials, func(_ uint64, c *types.WebAuthnCredential) bool { return c.UserID == userID })
+	s.logins = slices.DeleteFunc(s.logins, func(e types.LoginEvent) bool { return e.UserID == userID })
+}
+
+func (s *Store) GetUserRoles(userID uint64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var roles []string
+	for role := range s.userRoles[userID] {
+		roles = append(roles, role)
+	}
+	slices.Sort(roles)
+	return roles, nil
+}
+
+func (s *Store) GetUserPermissions(userID uint64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var permissions []string
+	for role := range s.userRoles[userID] {
+		permissions = append(permissions, s.rolePermissions[role]...)
+	}
+	slices.Sort(permissions)
+	return slices.Compact(permissions), nil
+}
+
+func (s *Store) GetRolePermissions(role string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	permissions, ok := s.rolePermissions[role]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	return slices.Sorted(slices.Values(permissions)), nil
+}
+
+func (s *Store) AssignRole(userID uint64, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return db.ErrNotFound
+	}
+	if _, ok := s.rolePermissions[role]; !ok {
+		return db.ErrNotFound
+	}
+	if s.userRoles[userID] == nil {
+		s.userRoles[userID] = map[string]bool{}
+	}
+	s.userRoles[userID][role] = true
+	return nil
+}
+
+func (s *Store) RemoveRole(userID uint64, role string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.userRoles[userID][role] {
+		return false, nil
+	}
+	delete(s.userRoles[userID], role)
+	s.revokeSessions(userID)
+	return true, nil
+}
+
+func (s *Store) CreateOAuthClient(client *types.OAuthClient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[client.ID]; ok {
+		return fmt.Errorf("memory: duplicate oauth client %q", client.ID)
+	}
+	client.CreatedAt = now()
+	stored := *client
+	stored.RedirectURIs = slices.Clone(client.RedirectURIs)
+	stored.Audiences = slices.Clone(client.Audiences)
+	s.clients[client.ID] = &stored
+	return nil
+}
+
+func (s *Store) GetOAuthClient(id string) (*types.OAuthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	client := *c
+	client.RedirectURIs = slices.Clone(c.RedirectURIs)
+	client.Audiences = slices.Clone(c.Audiences)
+	return &client, nil
+}
+
+// sortedValues returns the values of m ordered by cmp
+func sortedValues[K comparable, V any](m map[K]V, compare func(a, b V) int) []V {
+	values := slices.Collect(maps.Values(m))
+	slices.SortFunc(values, compare)
+	return values
+}
+
+// newestFirst orders rows by creation time, then ID, descending
+func newestFirst(aCreated, bCreated time.Time, aID, bID uint64) int {
+	if c := bCreated.Compare(aCreated); c != 0 {
+		return c
+	}
+	return cmp.Compare(bID, aID)
+}
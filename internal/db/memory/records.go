@@ -0,0 +1,379 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+func (s *Store) CreateSession(sess *types.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[sess.UserID]; !ok {
+		return fmt.Errorf("memory: session for unknown user %d", sess.UserID)
+	}
+	t := now()
+	sess.ID = s.nextID("sessions")
+	sess.CreatedAt, sess.LastSeenAt = t, t
+	s.sessions[sess.ID] = &session{Session: *sess}
+	return nil
+}
+
+func (s *Store) GetActiveSessions(userID uint64) ([]types.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := time.Now()
+	sessions := []types.Session{}
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && sess.active(t) {
+			sessions = append(sessions, sess.Session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b types.Session) int { return b.LastSeenAt.Compare(a.LastSeenAt) })
+	return sessions, nil
+}
+
+func (sess *session) active(t time.Time) bool {
+	return sess.revokedAt == nil && sess.ExpiresAt.After(t)
+}
+
+func (s *Store) TouchSession(id, userID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	t := now()
+	if !ok || sess.UserID != userID || !sess.active(t) {
+		return false, nil
+	}
+	if sess.LastSeenAt.Before(t.Add(-time.Minute)) {
+		sess.LastSeenAt = t
+	}
+	return true, nil
+}
+
+func (s *Store) RevokeSession(id, userID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || sess.UserID != userID || sess.revokedAt != nil {
+		return false, nil
+	}
+	t := now()
+	sess.revokedAt = &t
+	return true, nil
+}
+
+// revokeSessions revokes all active sessions of the user; the caller holds the lock
+func (s *Store) revokeSessions(userID uint64) {
+	t := now()
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && sess.revokedAt == nil {
+			sess.revokedAt = &t
+		}
+	}
+}
+
+func copyAPIKey(k *types.APIKey) *types.APIKey {
+	key := *k
+	key.Scopes = slices.Clone(k.Scopes)
+	return &key
+}
+
+func (s *Store) CreateAPIKey(key *types.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.KeyHash == key.KeyHash {
+			return fmt.Errorf("memory: duplicate api key hash")
+		}
+	}
+	key.ID = s.nextID("api_keys")
+	key.CreatedAt = now()
+	s.apiKeys[key.ID] = copyAPIKey(key)
+	return nil
+}
+
+func (s *Store) GetAPIKeyByHash(keyHash string) (*types.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.KeyHash == keyHash {
+			return copyAPIKey(k), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) ListAPIKeys() ([]types.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []types.APIKey{}
+	for _, k := range sortedValues(s.apiKeys, func(a, b *types.APIKey) int { return newestFirst(a.CreatedAt, b.CreatedAt, a.ID, b.ID) }) {
+		keys = append(keys, *copyAPIKey(k))
+	}
+	return keys, nil
+}
+
+func (s *Store) RevokeAPIKey(id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok || k.RevokedAt != nil {
+		return false, nil
+	}
+	t := now()
+	k.RevokedAt = &t
+	return true, nil
+}
+
+func (s *Store) TouchAPIKey(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+	if k, ok := s.apiKeys[id]; ok && (k.LastUsedAt == nil || k.LastUsedAt.Before(t.Add(-time.Minute))) {
+		k.LastUsedAt = &t
+	}
+	return nil
+}
+
+func (s *Store) SaveTOTPEnrollment(userID uint64, secretEncrypted []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.totp[userID]; ok && e.Confirmed() {
+		return db.ErrConflict
+	}
+	s.totp[userID] = &types.TOTPEnrollment{UserID: userID, SecretEncrypted: bytes.Clone(secretEncrypted), CreatedAt: now()}
+	return nil
+}
+
+func (s *Store) GetTOTPEnrollment(userID uint64) (*types.TOTPEnrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.totp[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	enrollment := *e
+	enrollment.SecretEncrypted = bytes.Clone(e.SecretEncrypted)
+	return &enrollment, nil
+}
+
+func (s *Store) UseTOTPStep(userID uint64, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.totp[userID]
+	if !ok || e.LastUsedStep >= step {
+		return false, nil
+	}
+	e.LastUsedStep = step
+	if e.ConfirmedAt == nil {
+		t := now()
+		e.ConfirmedAt = &t
+	}
+	return true, nil
+}
+
+func (s *Store) DeleteTOTPEnrollment(userID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.totp[userID]
+	delete(s.totp, userID)
+	return ok, nil
+}
+
+func copyCredential(c *types.WebAuthnCredential) *types.WebAuthnCredential {
+	credential := *c
+	credential.CredentialID = bytes.Clone(c.CredentialID)
+	credential.PublicKey = bytes.Clone(c.PublicKey)
+	credential.Transports = slices.Clone(c.Transports)
+	return &credential
+}
+
+func (s *Store) CreateWebAuthnCredential(c *types.WebAuthnCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.credentials {
+		if bytes.Equal(existing.CredentialID, c.CredentialID) {
+			return db.ErrConflict
+		}
+	}
+	if c.Transports == nil {
+		c.Transports = []string{}
+	}
+	c.ID = s.nextID("webauthn_credentials")
+	c.CreatedAt = now()
+	s.credentials[c.ID] = copyCredential(c)
+	return nil
+}
+
+func (s *Store) GetWebAuthnCredential(credentialID []byte) (*types.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			return copyCredential(c), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) ListWebAuthnCredentials(userID uint64) ([]types.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	credentials := []types.WebAuthnCredential{}
+	for _, c := range sortedValues(s.credentials, func(a, b *types.WebAuthnCredential) int { return newestFirst(a.CreatedAt, b.CreatedAt, a.ID, b.ID) }) {
+		if c.UserID == userID {
+			credentials = append(credentials, *copyCredential(c))
+		}
+	}
+	return credentials, nil
+}
+
+func (s *Store) UseWebAuthnCredential(id uint64, signCount uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.credentials[id]; ok {
+		t := now()
+		c.SignCount = signCount
+		c.LastUsedAt = &t
+	}
+	return nil
+}
+
+func (s *Store) DeleteWebAuthnCredential(id, userID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.credentials[id]
+	if !ok || c.UserID != userID {
+		return false, nil
+	}
+	delete(s.credentials, id)
+	return true, nil
+}
+
+func (s *Store) CreateImpersonationEvent(e *types.ImpersonationEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.ID = s.nextID("impersonation_log")
+	e.CreatedAt = now()
+	s.impersonations = append(s.impersonations, *e)
+	return nil
+}
+
+func (s *Store) CreateLoginEvent(e *types.LoginEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.UserID == 0 {
+		if u := s.userByPhone(e.Phone); u != nil {
+			e.UserID = u.ID
+		}
+	}
+	e.ID = s.nextID("login_events")
+	e.CreatedAt = now()
+	s.logins = append(s.logins, *e)
+
+	if u, ok := s.users[e.UserID]; ok && e.Outcome == types.LoginSuccess {
+		t := e.CreatedAt
+		u.LastLoginAt = &t
+	}
+	return nil
+}
+
+func (s *Store) ListLoginEvents(userID uint64, limit int, before uint64) ([]types.LoginEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []types.LoginEvent{}
+	for i := len(s.logins) - 1; i >= 0 && len(events) < limit; i-- {
+		e := s.logins[i]
+		if e.UserID == userID && (before == 0 || e.ID < before) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *Store) AppendAuditEntry(e *types.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(e.Details) == 0 {
+		e.Details = []byte("{}")
+	}
+	e.PrevHash = ""
+	if len(s.audit) > 0 {
+		e.PrevHash = s.audit[len(s.audit)-1].Hash
+	}
+	e.CreatedAt = now()
+	e.Hash = e.ComputeHash()
+	e.ID = s.nextID("audit_log")
+
+	entry := *e
+	entry.Details = bytes.Clone(e.Details)
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *Store) ListAuditEntries(filter db.AuditFilter, limit int, before uint64) ([]types.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := []types.AuditEntry{}
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		e := s.audit[i]
+		switch {
+		case before != 0 && e.ID >= before,
+			filter.Action != "" && e.Action != filter.Action,
+			filter.ActorUserID != 0 && e.ActorUserID != filter.ActorUserID,
+			filter.TargetUserID != 0 && e.TargetUserID != filter.TargetUserID,
+			!filter.From.IsZero() && e.CreatedAt.Before(filter.From),
+			!filter.To.IsZero() && !e.CreatedAt.Before(filter.To):
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *Store) VerifyAuditLog(ctx context.Context) (int, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prevHash := ""
+	for i := range s.audit {
+		if err := ctx.Err(); err != nil {
+			return i, prevHash, err
+		}
+		if err := db.CheckAuditEntry(&s.audit[i], prevHash); err != nil {
+			return i, prevHash, err
+		}
+		prevHash = s.audit[i].Hash
+	}
+	return len(s.audit), prevHash, nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// LegacyPhone is a stored phone number that is not in E.164 form
+type LegacyPhone struct {
+	UserID uint64
+	Phone  string
+}
+
+// legacyPhones selects the users whose phone is not in E.164 form; anonymized users are left out
+const legacyPhones = `FROM users WHERE deleted_at IS NULL AND phone !~ '^\+[1-9][0-9]{6,14}$'`
+
+// CountLegacyPhones returns how many users have a phone that is not in E.164 form. Logins look
+// users up by the E.164 number, so such users would get a second account.
+func (s *Store) CountLegacyPhones() (int, error) {
+	var n int
+	err := s.DB.QueryRow(`SELECT COUNT(*) ` + legacyPhones).Scan(&n)
+	return n, err
+}
+
+// GetLegacyPhones returns the users whose phone is not in E.164 form, registered before phone
+// numbers were normalized at login
+func (s *Store) GetLegacyPhones(ctx context.Context) ([]LegacyPhone, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, phone `+legacyPhones+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var phones []LegacyPhone
+	for rows.Next() {
+		var p LegacyPhone
+		if err := rows.Scan(&p.UserID, &p.Phone); err != nil {
+			return nil, err
+		}
+		phones = append(phones, p)
+	}
+	return phones, rows.Err()
+}
+
+// UpdateUserPhone replaces the phone number of a user; it returns ErrConflict if another user
+// has that number
+func (s *Store) UpdateUserPhone(id uint64, phone string) error {
+	res, err := s.DB.Exec(`UPDATE users SET phone = $2, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id, phone)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
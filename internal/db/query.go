@@ -0,0 +1,46 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// queryBuilder collects WHERE conditions with their arguments and numbers the placeholders,
+// so optional filters can be combined without tracking $n indexes by hand
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+// where adds a condition; each ? in cond is replaced by a placeholder bound to the next value
+func (b *queryBuilder) where(cond string, values ...any) {
+	var sb strings.Builder
+	for _, value := range values {
+		before, after, ok := strings.Cut(cond, "?")
+		if !ok {
+			panic("queryBuilder: more values than placeholders in " + cond)
+		}
+		sb.WriteString(before)
+		sb.WriteString(b.arg(value))
+		cond = after
+	}
+	if strings.Contains(cond, "?") {
+		panic("queryBuilder: more placeholders than values")
+	}
+	sb.WriteString(cond)
+	b.conditions = append(b.conditions, sb.String())
+}
+
+// arg binds value and returns its placeholder
+func (b *queryBuilder) arg(value any) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// whereClause returns the conditions joined by AND, or an empty string when there are none
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conditions, " AND ")
+}
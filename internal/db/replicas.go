@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// queryer is the part of *sql.DB that reads run against, so they can go to the primary or a replica
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// ReplicaStatus is the result of the last health check of a read replica
+type ReplicaStatus struct {
+	// Name is the replica's host and port, without credentials
+	Name    string
+	Healthy bool
+	// Lag is how far the replica's replay is behind, as of CheckedAt
+	Lag       time.Duration
+	Error     string
+	CheckedAt time.Time
+}
+
+type replica struct {
+	db *sql.DB
+
+	// healthy is read on every routed query; status is only read for reporting
+	healthy atomic.Bool
+	mu      sync.Mutex
+	status  ReplicaStatus
+}
+
+// AddReplica opens a read replica at dsn. It serves reads that tolerate replication lag once a
+// health check finds it reachable and within maxLag of the primary; a maxLag of 0 accepts any lag.
+func (s *Store) AddReplica(dsn string, maxLag time.Duration) error {
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	s.maxReplicaLag = maxLag
+	s.replicas = append(s.replicas, &replica{db: conn, status: ReplicaStatus{Name: dsnHost(dsn, len(s.replicas)+1)}})
+	return nil
+}
+
+// replicaLagQuery reports 0 when the replica has replayed everything it received, so an idle
+// primary does not make it look behind
+const replicaLagQuery = `
+	SELECT pg_is_in_recovery(), COALESCE(CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()) END, 0)`
+
+// CheckReplicas pings every replica, updates which ones serve reads and returns their status
+func (s *Store) CheckReplicas(ctx context.Context) []ReplicaStatus {
+	statuses := make([]ReplicaStatus, len(s.replicas))
+	for i, r := range s.replicas {
+		var inRecovery bool
+		var lagSeconds float64
+		err := r.db.QueryRowContext(ctx, replicaLagQuery).Scan(&inRecovery, &lagSeconds)
+		lag := time.Duration(lagSeconds * float64(time.Second))
+		switch {
+		case err != nil:
+		case !inRecovery:
+			err = errors.New("not a standby")
+		case s.maxReplicaLag > 0 && lag > s.maxReplicaLag:
+			err = fmt.Errorf("replication lag %s exceeds %s", lag.Round(time.Millisecond), s.maxReplicaLag)
+		}
+		statuses[i] = r.record(err, lag)
+	}
+	return statuses
+}
+
+// record stores the outcome of a check or a failed query and returns the new status
+func (r *replica) record(err error, lag time.Duration) ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.Healthy = err == nil
+	r.status.Lag = lag
+	r.status.Error = ""
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	r.status.CheckedAt = time.Now()
+	r.healthy.Store(err == nil)
+	return r.status
+}
+
+// Replicas returns the status of each read replica as of its last check
+func (s *Store) Replicas() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, len(s.replicas))
+	for i, r := range s.replicas {
+		r.mu.Lock()
+		statuses[i] = r.status
+		r.mu.Unlock()
+	}
+	return statuses
+}
+
+// pickReplica returns the healthy replicas in turn, or nil if there is none
+func (s *Store) pickReplica() *replica {
+	healthy := make([]*replica, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return healthy[s.nextReplica.Add(1)%uint64(len(healthy))]
+}
+
+// read runs fn on a healthy replica, or on the primary if there is none. A replica that cannot
+// be reached or is shutting down is taken out of rotation until the next health check and fn is
+// retried on the primary; a query canceled by replay is retried without ejecting the replica.
+// Any other error, such as bad input failing a cast, is the query's and is returned as is.
+func (s *Store) read(fn func(q queryer) error) error {
+	if r := s.pickReplica(); r != nil {
+		err := fn(r.db)
+		switch replicaFault(err) {
+		case faultNone:
+			return err
+		case faultReplica:
+			r.record(err, 0)
+		}
+	}
+	return fn(s.DB)
+}
+
+type fault int
+
+const (
+	// faultNone means the error, if any, would be the same on the primary
+	faultNone fault = iota
+	// faultTransient means the query may succeed on the primary but the replica is fine
+	faultTransient
+	// faultReplica means the replica itself is unusable
+	faultReplica
+)
+
+// replicaFault classifies an error returned by a query on a replica
+func replicaFault(err error) fault {
+	var pqErr *pq.Error
+	switch {
+	case err == nil, errors.Is(err, sql.ErrNoRows),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return faultNone
+	case errors.As(err, &pqErr):
+		if pqErr.Code == "57014" { // query_canceled, by statement_timeout or the client
+			return faultNone
+		}
+		switch pqErr.Code.Class() {
+		// connection exception, insufficient resources, operator intervention (e.g. shutdown),
+		// system error and internal error
+		case "08", "53", "57", "58", "XX":
+			return faultReplica
+		// transaction rollback, which on a standby is usually a conflict with recovery
+		case "40":
+			return faultTransient
+		}
+		return faultNone
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return faultReplica
+	}
+	return faultNone
+}
+
+// dsnHost returns the host and port of a URL or key=value DSN, falling back to the replica's
+// position so credentials never end up in health output
+func dsnHost(dsn string, n int) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		return u.Host
+	}
+	var host, port string
+	for _, field := range strings.Fields(dsn) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "host":
+			host = value
+		case "port":
+			port = value
+		}
+	}
+	if host == "" {
+		return fmt.Sprintf("replica-%d", n)
+	}
+	if port != "" {
+		return host + ":" + port
+	}
+	return host
+}
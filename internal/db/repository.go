@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// UserRepository is the storage the API and background jobs work against. Store implements it
+// on Postgres; the memory package implements it in process for tests and local development.
+//
+// Lookups of a single row that does not exist return sql.ErrNoRows, as database/sql does.
+type UserRepository interface {
+	// Ping checks that the storage is reachable
+	Ping(ctx context.Context) error
+
+	// Replicas reports the read replicas' health; it is empty when there are none
+	Replicas() []ReplicaStatus
+
+	UpsertUser(phone string) (*types.User, bool, error)
+	ImportUsers(users []ImportUser) (map[string]uint64, error)
+	// GetUserByID, GetUsers and GetUsersCount may be served by a replica and miss recent writes
+	GetUserByID(id uint64) (*types.User, error)
+	GetUserByIDPrimary(id uint64) (*types.User, error)
+	GetUserByPhone(phone string) (*types.User, error)
+	GetUsers(opts UserListOptions) ([]types.User, error)
+	GetUsersCount(filter UserFilter) (int, error)
+	// ExportUsers streams every matching user to fn without holding them all in memory
+	ExportUsers(ctx context.Context, filter UserFilter, sort UserSort, fn func(*types.User) error) error
+	UpdateUserProfile(id uint64, profile types.UserProfile, lastUpdatedAt time.Time) (*types.User, error)
+	SetUserStatus(id uint64, status types.UserStatus) (*types.User, error)
+	UserRestricted(id uint64) (bool, error)
+
+	ScheduleUserDeletion(id uint64, at time.Time) error
+	CancelUserDeletion(id uint64) (bool, error)
+	PurgeDeletedUsers(limit int) ([]uint64, error)
+	AnonymizeDeletedUsers(limit int) ([]uint64, error)
+
+	GetUserRoles(userID uint64) ([]string, error)
+	GetUserPermissions(userID uint64) ([]string, error)
+	GetRolePermissions(role string) ([]string, error)
+	AssignRole(userID uint64, role string) error
+	RemoveRole(userID uint64, role string) (bool, error)
+
+	CreateOAuthClient(client *types.OAuthClient) error
+	GetOAuthClient(id string) (*types.OAuthClient, error)
+
+	CreateSession(session *types.Session) error
+	GetActiveSessions(userID uint64) ([]types.Session, error)
+	TouchSession(id, userID uint64) (bool, error)
+	RevokeSession(id, userID uint64) (bool, error)
+
+	CreateAPIKey(key *types.APIKey) error
+	GetAPIKeyByHash(keyHash string) (*types.APIKey, error)
+	ListAPIKeys() ([]types.APIKey, error)
+	RevokeAPIKey(id uint64) (bool, error)
+	TouchAPIKey(id uint64) error
+
+	SaveTOTPEnrollment(userID uint64, secretEncrypted []byte) error
+	GetTOTPEnrollment(userID uint64) (*types.TOTPEnrollment, error)
+	UseTOTPStep(userID uint64, step int64) (bool, error)
+	DeleteTOTPEnrollment(userID uint64) (bool, error)
+
+	CreateWebAuthnCredential(c *types.WebAuthnCredential) error
+	GetWebAuthnCredential(credentialID []byte) (*types.WebAuthnCredential, error)
+	ListWebAuthnCredentials(userID uint64) ([]types.WebAuthnCredential, error)
+	UseWebAuthnCredential(id uint64, signCount uint32) error
+	DeleteWebAuthnCredential(id, userID uint64) (bool, error)
+
+	CreateImpersonationEvent(e *types.ImpersonationEvent) error
+	CreateLoginEvent(e *types.LoginEvent) error
+	ListLoginEvents(userID uint64, limit int, before uint64) ([]types.LoginEvent, error)
+
+	AppendAuditEntry(e *types.AuditEntry) error
+	ListAuditEntries(filter AuditFilter, limit int, before uint64) ([]types.AuditEntry, error)
+	VerifyAuditLog(ctx context.Context) (int, string, error)
+}
+
+var _ UserRepository = (*Store)(nil)
+
+// Ping checks the connection to Postgres
+func (s *Store) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
@@ -2,13 +2,22 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
+
 	"github.com/MiladJlz/dekamond-task/internal/types"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Store struct {
+	// DB is the primary; writes and reads that must see them go here
 	DB *sql.DB
+
+	replicas      []*replica
+	nextReplica   atomic.Uint64
+	maxReplicaLag time.Duration
 }
 
 func NewPostgresDB(dsn string) (*Store, error) {
@@ -19,76 +28,664 @@ func NewPostgresDB(dsn string) (*Store, error) {
 	return &Store{DB: db}, nil
 }
 
-func (s *Store) CreateUser(phone string) error {
-	_, err := s.DB.Exec(`INSERT INTO users (phone, created_at) VALUES ($1, NOW())`, phone)
-	return err
+const userColumns = `id, phone, display_name, email, locale, avatar_url, status, status_reason, status_expires_at,
+	created_at, updated_at, last_login_at, deletion_scheduled_at, deleted_at`
+
+// scanUser reads a row of userColumns, followed by extra columns scanned into extra
+func scanUser(row interface{ Scan(...any) error }, extra ...any) (*types.User, error) {
+	var user types.User
+	var statusExpiresAt, lastLoginAt, deletionScheduledAt, deletedAt sql.NullTime
+	dest := []any{&user.ID, &user.Phone, &user.DisplayName, &user.Email, &user.Locale, &user.AvatarURL,
+		&user.Status, &user.StatusReason, &statusExpiresAt,
+		&user.CreatedAt, &user.UpdatedAt, &lastLoginAt, &deletionScheduledAt, &deletedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	user.StatusExpiresAt = nullTimePtr(statusExpiresAt)
+	user.LastLoginAt = nullTimePtr(lastLoginAt)
+	user.DeletionScheduledAt = nullTimePtr(deletionScheduledAt)
+	user.DeletedAt = nullTimePtr(deletedAt)
+
+	// A suspension that has run out reads as active, matching the status filter
+	if !user.Restricted(time.Now()) {
+		user.UserStatus = types.UserStatus{Status: types.UserStatusActive}
+	}
+	return &user, nil
 }
 
-func (s *Store) UserExists(phone string) (bool, error) {
-	var exists bool
-	err := s.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE phone=$1)`, phone).Scan(&exists)
-	return exists, err
+// UpsertUser returns the user with phone, creating them if needed, and reports whether they were
+// created. It is a single statement, so concurrent calls for a new phone all get the same row.
+func (s *Store) UpsertUser(phone string) (*types.User, bool, error) {
+	var created bool
+	// The no-op update makes RETURNING see rows that already existed; xmax is 0 only for
+	// a freshly inserted row version
+	user, err := scanUser(s.DB.QueryRow(`
+		INSERT INTO users (phone, created_at) VALUES ($1, NOW())
+		ON CONFLICT (phone) DO UPDATE SET phone = EXCLUDED.phone
+		RETURNING `+userColumns+`, (xmax = 0)`, phone), &created)
+	if err != nil {
+		return nil, false, err
+	}
+	return user, created, nil
 }
 
+// GetUserByID reads the user from a replica when one is healthy, so a change made moments ago
+// may not be visible yet; use GetUserByIDPrimary when the caller needs to see it
 func (s *Store) GetUserByID(id uint64) (*types.User, error) {
-	var user types.User
-	err := s.DB.QueryRow(`SELECT id, phone, created_at FROM users WHERE id = $1`, id).Scan(&user.ID, &user.Phone, &user.CreatedAt)
+	var user *types.User
+	err := s.read(func(q queryer) error {
+		var err error
+		user, err = getUserByID(q, id)
+		return err
+	})
+	return user, err
+}
+
+// GetUserByIDPrimary reads the user from the primary
+func (s *Store) GetUserByIDPrimary(id uint64) (*types.User, error) {
+	return getUserByID(s.DB, id)
+}
+
+func getUserByID(q queryer, id uint64) (*types.User, error) {
+	return scanUser(q.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (s *Store) GetUserByPhone(phone string) (*types.User, error) {
+	return scanUser(s.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE phone = $1`, phone))
+}
+
+// UpdateUserProfile replaces the user's profile fields if the row was not modified since
+// lastUpdatedAt; it returns ErrConflict otherwise
+func (s *Store) UpdateUserProfile(id uint64, profile types.UserProfile, lastUpdatedAt time.Time) (*types.User, error) {
+	user, err := scanUser(s.DB.QueryRow(`
+		UPDATE users SET display_name = $2, email = $3, locale = $4, avatar_url = $5, updated_at = NOW()
+		WHERE id = $1 AND updated_at = $6
+		RETURNING `+userColumns,
+		id, profile.DisplayName, profile.Email, profile.Locale, profile.AvatarURL, lastUpdatedAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConflict
+	}
+	return user, err
+}
+
+// SetUserStatus changes the user's status and returns the updated user, or ErrNotFound. Blocking
+// or suspending also revokes all the user's sessions.
+func (s *Store) SetUserStatus(id uint64, status types.UserStatus) (*types.User, error) {
+	tx, err := s.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRow(`
+		UPDATE users SET status = $2, status_reason = $3, status_expires_at = $4
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+userColumns,
+		id, status.Status, status.StatusReason, status.StatusExpiresAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if status.Status != types.UserStatusActive {
+		if _, err := tx.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, id); err != nil {
+			return nil, err
+		}
+	}
+	return user, tx.Commit()
 }
 
-func (s *Store) GetUserByPhone(phone string) (*types.User, error) {
-	var user types.User
-	err := s.DB.QueryRow(`SELECT * FROM users WHERE phone = $1`, phone).Scan(&user.ID, &user.Phone, &user.CreatedAt)
+// UserRestricted reports whether the user is currently blocked or suspended; users that no
+// longer exist count as restricted
+func (s *Store) UserRestricted(id uint64) (bool, error) {
+	var restricted bool
+	err := s.DB.QueryRow(`
+		SELECT status <> 'active' AND (status_expires_at IS NULL OR status_expires_at > NOW())
+		FROM users WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&restricted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	return restricted, err
+}
+
+// ScheduleUserDeletion marks the user for deletion at the given time and revokes all their sessions
+func (s *Store) ScheduleUserDeletion(id uint64, at time.Time) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET deletion_scheduled_at = $2 WHERE id = $1`, id, at); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CancelUserDeletion clears a pending deletion; it returns false if none was scheduled
+func (s *Store) CancelUserDeletion(id uint64) (bool, error) {
+	res, err := s.DB.Exec(`UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// dueDeletions selects up to $1 accounts whose grace period is over, skipping rows locked by
+// a concurrent purge or login
+const dueDeletions = `
+	SELECT id FROM users
+	WHERE deletion_scheduled_at <= NOW()
+	ORDER BY deletion_scheduled_at
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED`
+
+// PurgeDeletedUsers hard-deletes up to limit accounts whose deletion is due and returns their IDs;
+// related rows go with them through ON DELETE CASCADE
+func (s *Store) PurgeDeletedUsers(limit int) ([]uint64, error) {
+	rows, err := s.DB.Query(`DELETE FROM users WHERE id IN (`+dueDeletions+`) RETURNING id`, limit)
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+	return scanIDs(rows)
+}
+
+// AnonymizeDeletedUsers scrubs the personal data of up to limit accounts whose deletion is due,
+// keeping the row so references from audit records stay valid, and returns their IDs
+func (s *Store) AnonymizeDeletedUsers(limit int) ([]uint64, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		UPDATE users SET phone = 'deleted:' || id, display_name = '', email = '', locale = '', avatar_url = '',
+			deletion_scheduled_at = NULL, deleted_at = NOW(), updated_at = NOW()
+		WHERE id IN (`+dueDeletions+`)
+		RETURNING id`, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil || len(ids) == 0 {
+		return ids, err
+	}
+
+	for _, table := range []string{"sessions", "user_roles", "user_totp", "webauthn_credentials", "login_events"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ANY($1)`, pq.Array(ids)); err != nil {
+			return nil, fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+	return ids, tx.Commit()
+}
+
+func scanIDs(rows *sql.Rows) ([]uint64, error) {
+	defer rows.Close()
+
+	ids := []uint64{}
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *Store) GetUserRoles(userID uint64) ([]string, error) {
+	rows, err := s.DB.Query(`SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (s *Store) GetUserPermissions(userID uint64) ([]string, error) {
+	rows, err := s.DB.Query(`
+		SELECT DISTINCT rp.permission
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role = ur.role
+		WHERE ur.user_id = $1
+		ORDER BY rp.permission`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (s *Store) CreateOAuthClient(client *types.OAuthClient) error {
+	var secretHash sql.NullString
+	if client.SecretHash != "" {
+		secretHash = sql.NullString{String: client.SecretHash, Valid: true}
+	}
+	return s.DB.QueryRow(`
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, audiences, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING created_at`,
+		client.ID, client.Name, secretHash, pq.Array(client.RedirectURIs), pq.Array(client.Audiences),
+	).Scan(&client.CreatedAt)
+}
+
+func (s *Store) GetOAuthClient(id string) (*types.OAuthClient, error) {
+	var client types.OAuthClient
+	var secretHash sql.NullString
+	err := s.DB.QueryRow(`
+		SELECT id, name, secret_hash, redirect_uris, audiences, created_at
+		FROM oauth_clients WHERE id = $1`, id,
+	).Scan(&client.ID, &client.Name, &secretHash, pq.Array(&client.RedirectURIs), pq.Array(&client.Audiences), &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	client.SecretHash = secretHash.String
+	return &client, nil
+}
+
+func (s *Store) CreateSession(session *types.Session) error {
+	return s.DB.QueryRow(`
+		INSERT INTO sessions (user_id, device_name, user_agent, ip_address, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW(), $5)
+		RETURNING id, created_at, last_seen_at`,
+		session.UserID, session.DeviceName, session.UserAgent, session.IPAddress, session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+}
+
+func (s *Store) GetActiveSessions(userID uint64) ([]types.Session, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, user_id, device_name, user_agent, ip_address, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []types.Session{}
+	for rows.Next() {
+		var session types.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession reports whether the session is still active and records activity at most once a minute
+func (s *Store) TouchSession(id, userID uint64) (bool, error) {
+	var active bool
+	err := s.DB.QueryRow(`
+		SELECT revoked_at IS NULL AND expires_at > NOW()
+		FROM sessions WHERE id = $1 AND user_id = $2`, id, userID).Scan(&active)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil || !active {
+		return false, err
+	}
+
+	_, err = s.DB.Exec(`UPDATE sessions SET last_seen_at = NOW() WHERE id = $1 AND last_seen_at < NOW() - INTERVAL '1 minute'`, id)
+	return true, err
+}
+
+// RevokeSession revokes one of the user's active sessions; it returns false if there was none
+func (s *Store) RevokeSession(id, userID uint64) (bool, error) {
+	res, err := s.DB.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+var (
+	// ErrNotFound is returned when a referenced row does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would replace state that must not change
+	ErrConflict = errors.New("conflict")
+)
+
+// AssignRole grants a role to a user; it returns ErrNotFound if the user or role does not exist
+func (s *Store) AssignRole(userID uint64, role string) error {
+	_, err := s.DB.Exec(`INSERT INTO user_roles (user_id, role, created_at) VALUES ($1, $2, NOW()) ON CONFLICT DO NOTHING`, userID, role)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return ErrNotFound
+	}
+	return err
+}
+
+// GetRolePermissions returns the permissions a role grants
+func (s *Store) GetRolePermissions(role string) ([]string, error) {
+	var permissions []string
+	err := s.DB.QueryRow(`
+		SELECT COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+		WHERE r.name = $1
+		GROUP BY r.name`, role).Scan(pq.Array(&permissions))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return permissions, err
+}
+
+// RemoveRole revokes a role from a user and all their sessions, since tokens carry the
+// permissions they were issued with; it returns false if the user did not have the role
+func (s *Store) RemoveRole(userID uint64, role string) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userID, role)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*types.APIKey, error) {
+	var key types.APIKey
+	var createdBy sql.NullInt64
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, pq.Array(&key.Scopes), &createdBy,
+		&key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.CreatedBy = uint64(createdBy.Int64)
+	key.ExpiresAt = nullTimePtr(expiresAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+	return &key, nil
 }
 
-func (s *Store) GetUsers(limit, offset int, search string) ([]types.User, error) {
-	query := `SELECT * FROM users`
-	args := []any{}
-	
-	if search != "" {
-		query += ` WHERE phone ILIKE $1`
-		args = append(args, "%"+search+"%")
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
 	}
-	
-	query += ` ORDER BY created_at DESC LIMIT $` + fmt.Sprintf("%d", len(args)+1) + ` OFFSET $` + fmt.Sprintf("%d", len(args)+2)
-	args = append(args, limit, offset)
-		
-	rows, err := s.DB.Query(query, args...)
+	return &t.Time
+}
+
+func (s *Store) CreateAPIKey(key *types.APIKey) error {
+	return s.DB.QueryRow(`
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NOW(), $6)
+		RETURNING id, created_at`,
+		key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), int64(key.CreatedBy), key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (s *Store) GetAPIKeyByHash(keyHash string) (*types.APIKey, error) {
+	return scanAPIKey(s.DB.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, keyHash))
+}
+
+func (s *Store) ListAPIKeys() ([]types.APIKey, error) {
+	rows, err := s.DB.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	
-	var users []types.User
+
+	keys := []types.APIKey{}
 	for rows.Next() {
-		var user types.User
-		err := rows.Scan(&user.ID, &user.Phone, &user.CreatedAt)
+		key, err := scanAPIKey(rows)
 		if err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes an active key; it returns false if there was none
+func (s *Store) RevokeAPIKey(id uint64) (bool, error) {
+	res, err := s.DB.Exec(`UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return false, err
 	}
-	
-	return users, nil
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
-func (s *Store) GetUsersCount(search string) (int, error) {
-	query := `SELECT COUNT(*) FROM users`
-	args := []any{}
-	
-	if search != "" {
-		query += ` WHERE phone ILIKE $1`
-		args = append(args, "%"+search+"%")
+// TouchAPIKey records key usage at most once a minute
+func (s *Store) TouchAPIKey(id uint64) error {
+	_, err := s.DB.Exec(`
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`, id)
+	return err
+}
+
+// SaveTOTPEnrollment stores a new unconfirmed secret; it returns ErrConflict if a confirmed one exists
+func (s *Store) SaveTOTPEnrollment(userID uint64, secretEncrypted []byte) error {
+	res, err := s.DB.Exec(`
+		INSERT INTO user_totp (user_id, secret_encrypted, created_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL`, userID, secretEncrypted)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *Store) GetTOTPEnrollment(userID uint64) (*types.TOTPEnrollment, error) {
+	var e types.TOTPEnrollment
+	var confirmedAt sql.NullTime
+	err := s.DB.QueryRow(`
+		SELECT user_id, secret_encrypted, confirmed_at, last_used_step, created_at
+		FROM user_totp WHERE user_id = $1`, userID,
+	).Scan(&e.UserID, &e.SecretEncrypted, &confirmedAt, &e.LastUsedStep, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.ConfirmedAt = nullTimePtr(confirmedAt)
+	return &e, nil
+}
+
+// UseTOTPStep records an accepted time step, confirming the enrollment on first use.
+// It returns false if the step was already used, so a code cannot be replayed.
+func (s *Store) UseTOTPStep(userID uint64, step int64) (bool, error) {
+	res, err := s.DB.Exec(`
+		UPDATE user_totp SET last_used_step = $2, confirmed_at = COALESCE(confirmed_at, NOW())
+		WHERE user_id = $1 AND last_used_step < $2`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteTOTPEnrollment removes the user's authenticator; it returns false if there was none
+func (s *Store) DeleteTOTPEnrollment(userID uint64) (bool, error) {
+	res, err := s.DB.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+const webAuthnCredentialColumns = `id, user_id, credential_id, public_key, sign_count, name, transports, created_at, last_used_at`
+
+func scanWebAuthnCredential(row interface{ Scan(...any) error }) (*types.WebAuthnCredential, error) {
+	var c types.WebAuthnCredential
+	var signCount int64
+	var lastUsedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.UserID, &c.CredentialID, &c.PublicKey, &signCount, &c.Name,
+		pq.Array(&c.Transports), &c.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.SignCount = uint32(signCount)
+	c.LastUsedAt = nullTimePtr(lastUsedAt)
+	return &c, nil
+}
+
+// CreateWebAuthnCredential stores a passkey; it returns ErrConflict if the credential is already registered
+func (s *Store) CreateWebAuthnCredential(c *types.WebAuthnCredential) error {
+	if c.Transports == nil {
+		c.Transports = []string{}
+	}
+	err := s.DB.QueryRow(`
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, name, transports, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at`,
+		c.UserID, c.CredentialID, c.PublicKey, int64(c.SignCount), c.Name, pq.Array(c.Transports),
+	).Scan(&c.ID, &c.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *Store) GetWebAuthnCredential(credentialID []byte) (*types.WebAuthnCredential, error) {
+	return scanWebAuthnCredential(s.DB.QueryRow(
+		`SELECT `+webAuthnCredentialColumns+` FROM webauthn_credentials WHERE credential_id = $1`, credentialID))
+}
+
+func (s *Store) ListWebAuthnCredentials(userID uint64) ([]types.WebAuthnCredential, error) {
+	rows, err := s.DB.Query(`SELECT `+webAuthnCredentialColumns+` FROM webauthn_credentials
+		WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []types.WebAuthnCredential{}
+	for rows.Next() {
+		c, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *c)
+	}
+
+	return credentials, rows.Err()
+}
+
+// UseWebAuthnCredential records a successful login with the authenticator's new signature counter
+func (s *Store) UseWebAuthnCredential(id uint64, signCount uint32) error {
+	_, err := s.DB.Exec(`UPDATE webauthn_credentials SET sign_count = $2, last_used_at = NOW() WHERE id = $1`,
+		id, int64(signCount))
+	return err
+}
+
+// DeleteWebAuthnCredential removes one of the user's passkeys; it returns false if there was none
+func (s *Store) DeleteWebAuthnCredential(id, userID uint64) (bool, error) {
+	res, err := s.DB.Exec(`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) CreateImpersonationEvent(e *types.ImpersonationEvent) error {
+	return s.DB.QueryRow(`
+		INSERT INTO impersonation_log (actor_id, target_id, reason, token_id, ip_address, user_agent, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), $7)
+		RETURNING id, created_at`,
+		e.ActorID, e.TargetID, e.Reason, e.TokenID, e.IPAddress, e.UserAgent, e.ExpiresAt,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// CreateLoginEvent records a login attempt. Without a UserID the user is looked up by phone.
+// A successful attempt also becomes the user's last_login_at.
+func (s *Store) CreateLoginEvent(e *types.LoginEvent) error {
+	userID := sql.NullInt64{Int64: int64(e.UserID), Valid: e.UserID != 0}
+	return s.DB.QueryRow(`
+		WITH event AS (
+			INSERT INTO login_events (user_id, phone, method, outcome, ip_address, user_agent, created_at)
+			VALUES (COALESCE($1, (SELECT id FROM users WHERE phone = $2)), $2, $3, $4, $5, $6, NOW())
+			RETURNING id, user_id, outcome, created_at
+		), last_login AS (
+			UPDATE users SET last_login_at = event.created_at
+			FROM event WHERE users.id = event.user_id AND event.outcome = 'success'
+		)
+		SELECT id, created_at FROM event`,
+		userID, e.Phone, e.Method, e.Outcome, e.IPAddress, e.UserAgent,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// ListLoginEvents returns up to limit of the user's login attempts, newest first, with IDs below
+// before when it is not 0
+func (s *Store) ListLoginEvents(userID uint64, limit int, before uint64) ([]types.LoginEvent, error) {
+	var b queryBuilder
+	b.where("user_id = ?", int64(userID))
+	if before != 0 {
+		b.where("id < ?", int64(before))
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT id, user_id, phone, method, outcome, ip_address, user_agent, created_at
+		FROM login_events`+b.whereClause()+`
+		ORDER BY id DESC LIMIT `+b.arg(limit), b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []types.LoginEvent{}
+	for rows.Next() {
+		var e types.LoginEvent
+		err := rows.Scan(&e.ID, &e.UserID, &e.Phone, &e.Method, &e.Outcome, &e.IPAddress, &e.UserAgent, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
 	}
-	
-	var count int
-	err := s.DB.QueryRow(query, args...).Scan(&count)
-	return count, err
+	return events, rows.Err()
 }
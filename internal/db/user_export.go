@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// exportBatchSize is how many rows each FETCH from the export cursor returns
+const exportBatchSize = 1000
+
+// ExportUsers calls fn with every user matching filter, in sort order. Rows are fetched in
+// batches through a server-side cursor, so memory use does not grow with the number of users.
+// It reads from a replica when one is healthy and stops when ctx is cancelled or fn fails.
+func (s *Store) ExportUsers(ctx context.Context, filter UserFilter, sort UserSort, fn func(*types.User) error) error {
+	query, args, err := userListQuery(UserListOptions{UserFilter: filter, Sort: sort})
+	if err != nil {
+		return err
+	}
+
+	// Only opening the cursor falls back to the primary; once rows were handed to fn a retry
+	// would repeat them
+	var tx *sql.Tx
+	if r := s.pickReplica(); r != nil {
+		if tx, err = declareExportCursor(ctx, r.db, query, args); err != nil && ctx.Err() == nil {
+			r.record(err, 0)
+		}
+	}
+	if tx == nil {
+		if tx, err = declareExportCursor(ctx, s.DB, query, args); err != nil {
+			return err
+		}
+	}
+	defer tx.Rollback()
+
+	fetch := `FETCH ` + strconv.Itoa(exportBatchSize) + ` FROM users_export`
+	for {
+		n, err := fetchExportBatch(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// declareExportCursor opens a read-only transaction on conn holding the users_export cursor
+func declareExportCursor(ctx context.Context, conn *sql.DB, query string, args []any) (*sql.Tx, error) {
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DECLARE users_export NO SCROLL CURSOR FOR `+query, args...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// fetchExportBatch passes the next batch of the cursor to fn and returns how many rows it had
+func fetchExportBatch(ctx context.Context, tx *sql.Tx, fetch string, fn func(*types.User) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return n, err
+		}
+		if err := fn(user); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/lib/pq"
+)
+
+// ImportUser is a user to create in a bulk import
+type ImportUser struct {
+	Phone   string
+	Profile types.UserProfile
+	// CreatedAt keeps the registration time from the source system; zero means now
+	CreatedAt time.Time
+}
+
+// ImportUsers creates the users whose phone is not registered yet and returns the IDs of the
+// created ones by phone; the others are left unchanged. The batch is loaded with COPY into a
+// temporary table and inserted in one statement, so it is created entirely or not at all.
+// Phones must be unique within users.
+func (s *Store) ImportUsers(users []ImportUser) (map[string]uint64, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		CREATE TEMPORARY TABLE users_import (
+			phone TEXT NOT NULL, display_name TEXT NOT NULL, email TEXT NOT NULL, locale TEXT NOT NULL,
+			avatar_url TEXT NOT NULL, created_at TIMESTAMPTZ
+		) ON COMMIT DROP`); err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("users_import", "phone", "display_name", "email", "locale", "avatar_url", "created_at"))
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		var createdAt *time.Time
+		if !u.CreatedAt.IsZero() {
+			createdAt = &u.CreatedAt
+		}
+		if _, err := stmt.Exec(u.Phone, u.Profile.DisplayName, u.Profile.Email, u.Profile.Locale, u.Profile.AvatarURL, createdAt); err != nil {
+			stmt.Close()
+			return nil, err
+		}
+	}
+	// The final Exec flushes the buffered rows
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	if err := stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	// The unique phone index does the dedupe: rows it rejects are not returned
+	rows, err := tx.Query(`
+		INSERT INTO users (phone, display_name, email, locale, avatar_url, created_at, updated_at)
+		SELECT phone, display_name, email, locale, avatar_url, COALESCE(created_at, NOW()), NOW() FROM users_import
+		ON CONFLICT (phone) DO NOTHING
+		RETURNING id, phone`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	created := make(map[string]uint64, len(users))
+	for rows.Next() {
+		var id uint64
+		var phone string
+		if err := rows.Scan(&id, &phone); err != nil {
+			return nil, err
+		}
+		created[phone] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return created, tx.Commit()
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// UserFilter narrows the user listing; zero fields do not filter
+type UserFilter struct {
+	// Search matches part of the phone number
+	Search string
+	// CountryCode matches the calling code of E.164 phone numbers, digits only (e.g. "98"). Phones
+	// are normalized to E.164 at login and import; older rows are rewritten by `server phones normalize`.
+	CountryCode string
+	// CreatedFrom and CreatedTo bound created_at, inclusive and exclusive respectively
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Status matches the current status, treating ended suspensions as active
+	Status string
+	// LastLoginFrom and LastLoginTo bound last_login_at; users who never logged in never match
+	LastLoginFrom time.Time
+	LastLoginTo   time.Time
+}
+
+// UserSort orders the user listing; ties are broken by id in the same direction
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultUserSort lists the newest users first
+var DefaultUserSort = UserSort{Field: "created_at", Desc: true}
+
+// userSortColumn is the SQL expression a field sorts by, the cursor value of a user for it and
+// a check that a cursor value has the field's type. The value is passed to Postgres as text and
+// cast by comparison with the expression, so a value that does not cast must be caught first.
+type userSortColumn struct {
+	expr  string
+	value func(u *types.User) string
+	valid func(v string) bool
+}
+
+// userSortColumns whitelists the fields users can be sorted by
+var userSortColumns = map[string]userSortColumn{
+	"created_at": {"created_at", func(u *types.User) string { return u.CreatedAt.Format(time.RFC3339Nano) }, validTimestamp},
+	"updated_at": {"updated_at", func(u *types.User) string { return u.UpdatedAt.Format(time.RFC3339Nano) }, validTimestamp},
+	"phone":      {"phone", func(u *types.User) string { return u.Phone }, func(string) bool { return true }},
+	// Users who never logged in sort as oldest; keyset comparisons cannot handle NULL
+	"last_login_at": {"COALESCE(last_login_at, '-infinity')", func(u *types.User) string {
+		if u.LastLoginAt == nil {
+			return "-infinity"
+		}
+		return u.LastLoginAt.Format(time.RFC3339Nano)
+	}, func(v string) bool { return v == "-infinity" || validTimestamp(v) }},
+	"id": {"id", nil, func(v string) bool { return v == "" }},
+}
+
+func validTimestamp(v string) bool {
+	_, err := time.Parse(time.RFC3339Nano, v)
+	return err == nil
+}
+
+// ValidUserSortField reports whether users can be sorted by field
+func ValidUserSortField(field string) bool {
+	_, ok := userSortColumns[field]
+	return ok
+}
+
+// UserCursor is the position of a user in a sorted listing
+type UserCursor struct {
+	// Value is the user's sort field value; empty when sorting by id
+	Value string
+	ID    uint64
+}
+
+// CursorFor returns the position of user in listings ordered by sort
+func (sort UserSort) CursorFor(user *types.User) UserCursor {
+	cursor := UserCursor{ID: user.ID}
+	if column := userSortColumns[sort.Field]; column.value != nil {
+		cursor.Value = column.value(user)
+	}
+	return cursor
+}
+
+// ValidCursor reports whether cursor's value has the type of the field sort orders by
+func (sort UserSort) ValidCursor(cursor UserCursor) bool {
+	column, ok := userSortColumns[sort.Field]
+	return ok && column.valid(cursor.Value)
+}
+
+// UserListOptions selects a page of users. With After set the page starts after that user
+// (keyset pagination) and Offset is ignored.
+type UserListOptions struct {
+	UserFilter
+	Sort   UserSort
+	Limit  int
+	Offset int
+	After  *UserCursor
+}
+
+// apply adds the filter conditions to b
+func (f UserFilter) apply(b *queryBuilder) {
+	b.where("deleted_at IS NULL")
+	if f.Search != "" {
+		b.where("phone ILIKE ?", "%"+f.Search+"%")
+	}
+	if f.CountryCode != "" {
+		b.where("phone LIKE ?", "+"+f.CountryCode+"%")
+	}
+	if !f.CreatedFrom.IsZero() {
+		b.where("created_at >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		b.where("created_at < ?", f.CreatedTo)
+	}
+	switch f.Status {
+	case "":
+	case types.UserStatusActive:
+		b.where("(status = 'active' OR status_expires_at <= NOW())")
+	default:
+		b.where("status = ? AND (status_expires_at IS NULL OR status_expires_at > NOW())", f.Status)
+	}
+	if !f.LastLoginFrom.IsZero() {
+		b.where("last_login_at >= ?", f.LastLoginFrom)
+	}
+	if !f.LastLoginTo.IsZero() {
+		b.where("last_login_at < ?", f.LastLoginTo)
+	}
+}
+
+// Matches reports whether user passes the filter; it mirrors apply for stores that filter in Go
+// and expects expired suspensions to read as active already
+func (f UserFilter) Matches(user *types.User) bool {
+	switch {
+	case user.DeletedAt != nil:
+		return false
+	case f.Search != "" && !strings.Contains(strings.ToLower(user.Phone), strings.ToLower(f.Search)):
+		return false
+	case f.CountryCode != "" && !strings.HasPrefix(user.Phone, "+"+f.CountryCode):
+		return false
+	case !f.CreatedFrom.IsZero() && user.CreatedAt.Before(f.CreatedFrom):
+		return false
+	case !f.CreatedTo.IsZero() && !user.CreatedAt.Before(f.CreatedTo):
+		return false
+	case f.Status != "" && user.Status != f.Status:
+		return false
+	case (!f.LastLoginFrom.IsZero() || !f.LastLoginTo.IsZero()) && user.LastLoginAt == nil:
+		return false
+	case !f.LastLoginFrom.IsZero() && user.LastLoginAt.Before(f.LastLoginFrom):
+		return false
+	case !f.LastLoginTo.IsZero() && !user.LastLoginAt.Before(f.LastLoginTo):
+		return false
+	}
+	return true
+}
+
+// Compare orders two positions in ascending sort order, for stores that sort in Go
+func (sort UserSort) Compare(a, b UserCursor) int {
+	if sort.Field == "id" {
+		return cmp.Compare(a.ID, b.ID)
+	}
+	var c int
+	if sort.Field == "phone" {
+		c = strings.Compare(a.Value, b.Value)
+	} else {
+		c = sortTime(a.Value).Compare(sortTime(b.Value))
+	}
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// sortTime parses the cursor value of a timestamp field; "-infinity" is the zero time
+func sortTime(v string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, v)
+	return t
+}
+
+// GetUsers reads from a replica when one is healthy
+func (s *Store) GetUsers(opts UserListOptions) ([]types.User, error) {
+	// Built up front so a bad request does not count against the replica
+	query, args, err := userListQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []types.User
+	err = s.read(func(q queryer) error {
+		users, err = getUsers(q, query, args)
+		return err
+	})
+	return users, err
+}
+
+func getUsers(q queryer, query string, args []any) ([]types.User, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []types.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// userListQuery builds the listing query for opts; a Limit of 0 returns every matching user
+func userListQuery(opts UserListOptions) (string, []any, error) {
+	sort := opts.Sort
+	if sort.Field == "" {
+		sort = DefaultUserSort
+	}
+	column, ok := userSortColumns[sort.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported sort field %q", sort.Field)
+	}
+
+	var b queryBuilder
+	opts.UserFilter.apply(&b)
+
+	direction, comparison := "ASC", ">"
+	if sort.Desc {
+		direction, comparison = "DESC", "<"
+	}
+	if opts.After != nil {
+		if sort.Field == "id" {
+			b.where("id "+comparison+" ?", opts.After.ID)
+		} else {
+			b.where("("+column.expr+", id) "+comparison+" (?, ?)", opts.After.Value, opts.After.ID)
+		}
+	}
+
+	// column.expr comes from the whitelist, never from user input
+	query := `SELECT ` + userColumns + ` FROM users` + b.whereClause()
+	if sort.Field == "id" {
+		query += ` ORDER BY id ` + direction
+	} else {
+		query += ` ORDER BY ` + column.expr + ` ` + direction + `, id ` + direction
+	}
+	if opts.Limit > 0 {
+		query += ` LIMIT ` + b.arg(opts.Limit)
+	}
+	if opts.After == nil && opts.Offset > 0 {
+		query += ` OFFSET ` + b.arg(opts.Offset)
+	}
+	return query, b.args, nil
+}
+
+// GetUsersCount reads from a replica when one is healthy
+func (s *Store) GetUsersCount(filter UserFilter) (int, error) {
+	var b queryBuilder
+	filter.apply(&b)
+
+	var count int
+	err := s.read(func(q queryer) error {
+		return q.QueryRow(`SELECT COUNT(*) FROM users`+b.whereClause(), b.args...).Scan(&count)
+	})
+	return count, err
+}
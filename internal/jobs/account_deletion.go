@@ -0,0 +1,62 @@
+// Package jobs contains background work that runs alongside the API server
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"go.uber.org/zap"
+)
+
+// accountPurgeBatchSize bounds how many accounts one pass removes, keeping transactions short
+const accountPurgeBatchSize = 100
+
+// AccountDeletion removes accounts whose deletion grace period has ended
+type AccountDeletion struct {
+	Store db.UserRepository
+	// Anonymize keeps the user rows with their personal data scrubbed instead of deleting them
+	Anonymize bool
+	Interval  time.Duration
+	Logger    *zap.SugaredLogger
+}
+
+// Run purges due accounts every Interval until ctx is cancelled
+func (j *AccountDeletion) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge processes due accounts in batches until none are left
+func (j *AccountDeletion) purge(ctx context.Context) {
+	for ctx.Err() == nil {
+		var ids []uint64
+		var err error
+		if j.Anonymize {
+			ids, err = j.Store.AnonymizeDeletedUsers(accountPurgeBatchSize)
+		} else {
+			ids, err = j.Store.PurgeDeletedUsers(accountPurgeBatchSize)
+		}
+		if err != nil {
+			j.Logger.Errorw("account purge failed", "error", err, "anonymize", j.Anonymize)
+			return
+		}
+
+		for _, id := range ids {
+			j.Logger.Infow("account purged", "user_id", id, "anonymize", j.Anonymize)
+		}
+		if len(ids) < accountPurgeBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"go.uber.org/zap"
+)
+
+// ReplicaHealth checks the store's read replicas, taking unreachable or lagging ones out of
+// rotation and putting them back once they recover
+type ReplicaHealth struct {
+	Store    *db.Store
+	Interval time.Duration
+	Logger   *zap.SugaredLogger
+}
+
+// Run checks the replicas every Interval until ctx is cancelled
+func (j *ReplicaHealth) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	healthy := map[string]bool{}
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, j.Interval)
+		for _, status := range j.Store.CheckReplicas(checkCtx) {
+			// Log changes only, the first check included
+			if was, seen := healthy[status.Name]; !seen || was != status.Healthy {
+				if status.Healthy {
+					j.Logger.Infow("read replica up", "replica", status.Name, "lag", status.Lag)
+				} else {
+					j.Logger.Warnw("read replica down", "replica", status.Name, "error", status.Error)
+				}
+			}
+			healthy[status.Name] = status.Healthy
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package otp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// RandomToken returns a URL-safe random string carrying n bytes of entropy
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SaveAuthorizationRequest stores a pending authorization request and returns its ID
+func (r *RedisOTP) SaveAuthorizationRequest(req *types.AuthorizationRequest, ttl time.Duration) (string, error) {
+	id, err := RandomToken(24)
+	if err != nil {
+		return "", err
+	}
+	if err := r.setJSON(fmt.Sprintf("authreq:%s", id), req, ttl); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// GetAuthorizationRequest loads a pending authorization request; it returns nil if it expired
+func (r *RedisOTP) GetAuthorizationRequest(id string) (*types.AuthorizationRequest, error) {
+	var req types.AuthorizationRequest
+	found, err := r.getJSON(fmt.Sprintf("authreq:%s", id), &req, false)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// DeleteAuthorizationRequest removes a pending authorization request once it has been completed
+func (r *RedisOTP) DeleteAuthorizationRequest(id string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return r.client.Del(timeoutCtx, fmt.Sprintf("authreq:%s", id)).Err()
+}
+
+// SaveAuthorizationCode stores a single-use authorization code and returns it
+func (r *RedisOTP) SaveAuthorizationCode(grant *types.AuthorizationCode, ttl time.Duration) (string, error) {
+	code, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := r.setJSON(fmt.Sprintf("authcode:%s", code), grant, ttl); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ConsumeAuthorizationCode atomically loads and deletes an authorization code; it returns nil if unknown
+func (r *RedisOTP) ConsumeAuthorizationCode(code string) (*types.AuthorizationCode, error) {
+	var grant types.AuthorizationCode
+	found, err := r.getJSON(fmt.Sprintf("authcode:%s", code), &grant, true)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (r *RedisOTP) setJSON(key string, v any, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return r.client.Set(timeoutCtx, key, data, ttl).Err()
+}
+
+func (r *RedisOTP) getJSON(key string, v any, consume bool) (bool, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	var data []byte
+	var err error
+	if consume {
+		data, err = r.client.GetDel(timeoutCtx, key).Bytes()
+	} else {
+		data, err = r.client.Get(timeoutCtx, key).Bytes()
+	}
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, v)
+}
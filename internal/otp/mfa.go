@@ -0,0 +1,64 @@
+package otp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/types"
+	"github.com/redis/go-redis/v9"
+)
+
+// SaveMFAChallenge stores a pending second-factor login and returns the opaque challenge token
+func (r *RedisOTP) SaveMFAChallenge(challenge *types.MFAChallenge, ttl time.Duration) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := r.setJSON(fmt.Sprintf("mfa:%s", token), challenge, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetMFAChallenge loads a pending second-factor login; it returns nil if it expired
+func (r *RedisOTP) GetMFAChallenge(token string) (*types.MFAChallenge, error) {
+	var challenge types.MFAChallenge
+	found, err := r.getJSON(fmt.Sprintf("mfa:%s", token), &challenge, false)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// countMFAAttempt increments the attempt counter of a challenge, giving it the challenge's
+// expiry when it is created
+var countMFAAttempt = redis.NewScript(`
+local n = redis.call("INCR", KEYS[2])
+if n == 1 then
+	local ttl = redis.call("PTTL", KEYS[1])
+	if ttl > 0 then
+		redis.call("PEXPIRE", KEYS[2], ttl)
+	else
+		redis.call("DEL", KEYS[2])
+	end
+end
+return n`)
+
+// CountMFAAttempt records an attempt at a challenge and returns how many were made so far,
+// including this one. The count is atomic, so concurrent attempts are all counted.
+func (r *RedisOTP) CountMFAAttempt(token string) (int64, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	keys := []string{fmt.Sprintf("mfa:%s", token), fmt.Sprintf("mfa_attempts:%s", token)}
+	return countMFAAttempt.Run(timeoutCtx, r.client, keys).Int64()
+}
+
+// DeleteMFAChallenge removes a challenge once it was completed or exhausted
+func (r *RedisOTP) DeleteMFAChallenge(token string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return r.client.Del(timeoutCtx, fmt.Sprintf("mfa:%s", token), fmt.Sprintf("mfa_attempts:%s", token)).Err()
+}
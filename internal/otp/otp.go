@@ -42,10 +42,26 @@ func generateRandomOTP() string {
 	return fmt.Sprintf("%06d", n.Int64()+100000)
 }
 
-// Generate creates and stores an OTP in Redis
-func (r *RedisOTP) Generate(phone string) (string, error) {
+// Purpose scopes a code to the flow it was requested for, so a code sent to log in cannot
+// confirm a step-up or an account deletion, and the other way around
+type Purpose string
+
+const (
+	PurposeLogin  Purpose = ""
+	PurposeStepUp Purpose = "stepup"
+)
+
+func otpKey(purpose Purpose, phone string) string {
+	if purpose == PurposeLogin {
+		return fmt.Sprintf("otp:%s", phone)
+	}
+	return fmt.Sprintf("otp:%s:%s", purpose, phone)
+}
+
+// Generate creates and stores an OTP for purpose in Redis
+func (r *RedisOTP) Generate(purpose Purpose, phone string) (string, error) {
 	code := generateRandomOTP()
-	key := fmt.Sprintf("otp:%s", phone)
+	key := otpKey(purpose, phone)
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
@@ -57,9 +73,9 @@ func (r *RedisOTP) Generate(phone string) (string, error) {
 	return code, nil
 }
 
-// Validate verifies an OTP from Redis and deletes it on success
-func (r *RedisOTP) Validate(phone, code string) (bool, error) {
-	key := fmt.Sprintf("otp:%s", phone)
+// Validate verifies an OTP generated for purpose and deletes it on success
+func (r *RedisOTP) Validate(purpose Purpose, phone, code string) (bool, error) {
+	key := otpKey(purpose, phone)
 
 	// Use a timeout context for Redis operations
 	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
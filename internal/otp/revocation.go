@@ -0,0 +1,31 @@
+package otp
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RevokeToken denylists a token ID until the token would have expired anyway
+func (r *RedisOTP) RevokeToken(tokenID string, remaining time.Duration) error {
+	if remaining <= 0 {
+		return nil
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return r.client.Set(timeoutCtx, fmt.Sprintf("revoked:%s", tokenID), 1, remaining).Err()
+}
+
+// IsTokenRevoked reports whether a token ID has been denylisted
+func (r *RedisOTP) IsTokenRevoked(tokenID string) (bool, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	n, err := r.client.Exists(timeoutCtx, fmt.Sprintf("revoked:%s", tokenID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
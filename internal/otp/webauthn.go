@@ -0,0 +1,31 @@
+package otp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// SaveWebAuthnChallenge stores a pending passkey ceremony and returns its random challenge,
+// base64url encoded as it appears in the client data
+func (r *RedisOTP) SaveWebAuthnChallenge(challenge *types.WebAuthnChallenge, ttl time.Duration) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := r.setJSON(fmt.Sprintf("webauthn:%s", token), challenge, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeWebAuthnChallenge atomically loads and deletes a pending ceremony; it returns nil if unknown or expired
+func (r *RedisOTP) ConsumeWebAuthnChallenge(token string) (*types.WebAuthnChallenge, error) {
+	var challenge types.WebAuthnChallenge
+	found, err := r.getJSON(fmt.Sprintf("webauthn:%s", token), &challenge, true)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &challenge, nil
+}
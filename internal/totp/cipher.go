@@ -0,0 +1,51 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// Cipher encrypts TOTP secrets at rest with AES-256-GCM
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a cipher from a 32-byte key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, errors.New("totp encryption key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt seals the secret; aad binds the ciphertext to its owner so rows cannot be swapped
+func (c *Cipher) Encrypt(secret string, aad []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, []byte(secret), aad), nil
+}
+
+// Decrypt opens a secret sealed by Encrypt with the same aad
+func (c *Cipher) Decrypt(ciphertext, aad []byte) (string, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return "", errors.New("ciphertext too short")
+	}
+	plaintext, err := c.aead.Open(nil, ciphertext[:size], ciphertext[size:], aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
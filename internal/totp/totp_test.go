@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 Appendix B test vectors
+const rfc6238Secret = "12345678901234567890"
+
+// rfc6238Vectors are the SHA-1 values of RFC 6238 Appendix B, truncated to the last 6 of their 8 digits
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestGenerateRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		if got := generate([]byte(rfc6238Secret), v.unix/Period); got != v.code {
+			t.Errorf("T=%d: generate = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	secret := encoding.EncodeToString([]byte(rfc6238Secret))
+	for _, v := range rfc6238Vectors {
+		step, ok := Validate(secret, v.code, time.Unix(v.unix, 0))
+		if !ok || step != v.unix/Period {
+			t.Errorf("T=%d: Validate = %d, %t, want %d, true", v.unix, step, ok, v.unix/Period)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	secret := encoding.EncodeToString([]byte(rfc6238Secret))
+	// The code of step 37037036, which runs from 1111111080 to 1111111109
+	const code, step = "081804", 1111111109 / Period
+
+	tests := []struct {
+		unix int64
+		ok   bool
+	}{
+		{1111111049, false}, // last second of the step two before
+		{1111111050, true},  // first second of the step before
+		{1111111080, true},
+		{1111111109, true},
+		{1111111139, true},  // last second of the step after
+		{1111111140, false}, // first second of the step two after
+	}
+	for _, tt := range tests {
+		got, ok := Validate(secret, code, time.Unix(tt.unix, 0))
+		if ok != tt.ok {
+			t.Errorf("T=%d: Validate ok = %t, want %t", tt.unix, ok, tt.ok)
+		}
+		if ok && got != step {
+			t.Errorf("T=%d: Validate step = %d, want %d", tt.unix, got, step)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedInput(t *testing.T) {
+	secret := encoding.EncodeToString([]byte(rfc6238Secret))
+	now := time.Unix(59, 0)
+
+	for _, code := range []string{"", "28708", "2870820", "0287082", "abcdef"} {
+		if _, ok := Validate(secret, code, now); ok {
+			t.Errorf("Validate accepted code %q", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "287082", now); ok {
+		t.Error("Validate accepted an invalid secret")
+	}
+	if _, ok := Validate(encoding.EncodeToString([]byte("another secret")), "287082", now); ok {
+		t.Error("Validate accepted the code of another secret")
+	}
+}
+
+func TestValidateAcceptsLowercaseSecret(t *testing.T) {
+	secret := strings.ToLower(encoding.EncodeToString([]byte(rfc6238Secret)))
+	if _, ok := Validate(secret, "287082", time.Unix(59, 0)); !ok {
+		t.Error("Validate rejected a lowercase secret")
+	}
+}
@@ -0,0 +1,23 @@
+package types
+
+import "time"
+
+// APIKey is a credential for backend services calling the API without a phone login
+// @Description API key metadata; the key itself is only returned on creation
+type APIKey struct {
+	ID         uint64     `json:"id" example:"7" description:"API key identifier"`
+	Name       string     `json:"name" example:"nightly-report" description:"Human readable key name"`
+	Prefix     string     `json:"prefix" example:"dk_Q2hhbmdl" description:"First characters of the key"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes" description:"Permissions granted to the key"`
+	CreatedBy  uint64     `json:"created_by,omitempty" example:"1" description:"User who created the key"`
+	CreatedAt  time.Time  `json:"created_at" example:"2025-08-19T12:00:00Z" description:"Creation time"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" example:"2026-08-19T12:00:00Z" description:"Expiration time; never expires when empty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" example:"2025-08-19T12:30:00Z" description:"Last successful authentication"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" description:"Revocation time"`
+}
+
+// Active reports whether the key can still authenticate at time now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
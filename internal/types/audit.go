@@ -0,0 +1,71 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditOTPRequested      = "otp.requested"
+	AuditOTPVerified       = "otp.verified"
+	AuditOTPFailed         = "otp.failed"
+	AuditUserCreated       = "user.created"
+	AuditTokenIssued       = "token.issued"
+	AuditRoleGranted       = "role.granted"
+	AuditRoleRevoked       = "role.revoked"
+	AuditUserBlocked       = "user.blocked"
+	AuditUserUnblocked     = "user.unblocked"
+	AuditUserImpersonated  = "user.impersonated"
+	AuditAPIKeyCreated     = "api_key.created"
+	AuditAPIKeyRevoked     = "api_key.revoked"
+	AuditClientRegistered  = "client.registered"
+	AuditDeletionScheduled = "user.deletion_scheduled"
+	AuditUsersExported     = "users.exported"
+	AuditUsersImported     = "users.imported"
+	AuditPhonesNormalized  = "users.phones_normalized"
+)
+
+// AuditEntry is one record of the append-only audit log. Each entry's hash covers the previous
+// entry's hash, so changing or removing an entry breaks the chain from there on.
+// @Description Audit log entry
+type AuditEntry struct {
+	ID     uint64 `json:"id" example:"1024" description:"Entry identifier, in write order"`
+	Action string `json:"action" example:"role.granted" description:"What happened"`
+	// ActorUserID and ActorAPIKeyID identify who performed the action; both are 0 for anonymous requests
+	ActorUserID   uint64          `json:"actor_user_id,omitempty" example:"1" description:"User who performed the action; for impersonated requests the staff member"`
+	ActorAPIKeyID uint64          `json:"actor_api_key_id,omitempty" example:"3" description:"API key that performed the action"`
+	TargetUserID  uint64          `json:"target_user_id,omitempty" example:"42" description:"User the action concerns"`
+	IPAddress     string          `json:"ip_address" example:"203.0.113.7" description:"IP address of the request"`
+	Details       json.RawMessage `json:"details" swaggertype:"object" description:"Action specific fields"`
+	CreatedAt     time.Time       `json:"created_at" example:"2025-08-19T12:00:00Z" description:"When the action happened"`
+	PrevHash      string          `json:"prev_hash" example:"" description:"Hash of the previous entry, empty for the first one"`
+	Hash          string          `json:"hash" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" description:"SHA-256 over prev_hash and this entry's fields, hex encoded"`
+}
+
+// ComputeHash returns the chain hash of the entry: SHA-256 over PrevHash and every field except
+// ID and Hash, each prefixed with its length so field boundaries cannot shift
+func (e *AuditEntry) ComputeHash() string {
+	fields := []string{
+		e.PrevHash,
+		e.Action,
+		strconv.FormatUint(e.ActorUserID, 10),
+		strconv.FormatUint(e.ActorAPIKeyID, 10),
+		strconv.FormatUint(e.TargetUserID, 10),
+		e.IPAddress,
+		string(e.Details),
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	h := sha256.New()
+	var size [binary.MaxVarintLen64]byte
+	for _, field := range fields {
+		h.Write(size[:binary.PutUvarint(size[:], uint64(len(field)))])
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
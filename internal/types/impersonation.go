@@ -0,0 +1,16 @@
+package types
+
+import "time"
+
+// ImpersonationEvent records a staff member minting a token to act as another user
+type ImpersonationEvent struct {
+	ID        uint64
+	ActorID   uint64
+	TargetID  uint64
+	Reason    string
+	TokenID   string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,33 @@
+package types
+
+import "time"
+
+// Login methods
+const (
+	LoginMethodOTP     = "otp"
+	LoginMethodTOTP    = "totp"
+	LoginMethodPasskey = "passkey"
+)
+
+// Login outcomes
+const (
+	LoginSuccess     = "success"
+	LoginInvalidCode = "invalid_code"
+	LoginBlocked     = "blocked"
+	// LoginMFARequired means the OTP was correct and a second factor was asked for
+	LoginMFARequired = "mfa_required"
+)
+
+// LoginEvent records one login attempt
+// @Description Login attempt with its outcome
+type LoginEvent struct {
+	ID uint64 `json:"id" example:"301" description:"Event identifier"`
+	// UserID is 0 for attempts on phone numbers without an account
+	UserID    uint64    `json:"-"`
+	Phone     string    `json:"-"`
+	Method    string    `json:"method" example:"otp" enums:"otp,totp,passkey" description:"How the user tried to log in"`
+	Outcome   string    `json:"outcome" example:"success" enums:"success,invalid_code,blocked,mfa_required" description:"Result of the attempt"`
+	IPAddress string    `json:"ip_address" example:"203.0.113.7" description:"IP address of the request"`
+	UserAgent string    `json:"user_agent" example:"Mozilla/5.0 (Linux; Android 14)" description:"User agent of the request"`
+	CreatedAt time.Time `json:"created_at" example:"2025-08-19T12:00:00Z" description:"Attempt time"`
+}
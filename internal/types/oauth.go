@@ -0,0 +1,50 @@
+package types
+
+import (
+	"slices"
+	"time"
+)
+
+// OAuthClient is an application registered to sign users in through the OIDC provider
+// @Description Registered OIDC client application
+type OAuthClient struct {
+	ID           string    `json:"client_id" example:"c_3f9a1b2c4d5e6f70" description:"Client identifier"`
+	Name         string    `json:"name" example:"Web App" description:"Human readable client name"`
+	SecretHash   string    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris" description:"Allowed redirect URIs"`
+	Audiences    []string  `json:"audiences" description:"Audiences minted into access tokens for this client"`
+	CreatedAt    time.Time `json:"created_at" example:"2025-08-19T12:00:00Z" description:"Registration timestamp"`
+}
+
+// Confidential reports whether the client must authenticate with a secret at the token endpoint
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AllowsRedirect reports whether uri exactly matches one of the registered redirect URIs
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AuthorizationRequest is a pending /authorize request waiting for the user to log in
+type AuthorizationRequest struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	State         string `json:"state"`
+	Nonce         string `json:"nonce"`
+	CodeChallenge string `json:"code_challenge"`
+}
+
+// AuthorizationCode is the grant issued to a client after a successful login
+type AuthorizationCode struct {
+	ClientID      string    `json:"client_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	Nonce         string    `json:"nonce"`
+	CodeChallenge string    `json:"code_challenge"`
+	UserID        uint64    `json:"user_id"`
+	SessionID     uint64    `json:"session_id"`
+	AuthTime      time.Time `json:"auth_time"`
+	AMR           []string  `json:"amr"`
+}
@@ -0,0 +1,113 @@
+package types
+
+import (
+	"errors"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Profile field limits
+const (
+	maxDisplayNameLength = 100
+	maxEmailLength       = 254
+	maxAvatarURLLength   = 2048
+)
+
+// localePattern accepts BCP 47 language tags such as "en", "en-US" or "zh-Hant-TW"
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8}){0,3}$`)
+
+// NormalizeDisplayName trims name and checks its length and characters
+func NormalizeDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxDisplayNameLength || strings.ContainsFunc(name, unicode.IsControl) {
+		return "", errors.New("display_name must be at most 100 characters without control characters")
+	}
+	return name, nil
+}
+
+// NormalizeEmail trims email and checks that it is a plain address; empty is allowed
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email || len(email) > maxEmailLength {
+			return "", errors.New("email must be a plain email address")
+		}
+	}
+	return email, nil
+}
+
+// NormalizeLocale trims locale and checks that it is a BCP 47 tag; empty is allowed
+func NormalizeLocale(locale string) (string, error) {
+	locale = strings.TrimSpace(locale)
+	if locale != "" && !localePattern.MatchString(locale) {
+		return "", errors.New("locale must be a BCP 47 language tag such as en-US")
+	}
+	return locale, nil
+}
+
+// NormalizeAvatarURL trims avatar and checks that it is an https URL; empty is allowed
+func NormalizeAvatarURL(avatar string) (string, error) {
+	avatar = strings.TrimSpace(avatar)
+	if avatar != "" {
+		u, err := url.Parse(avatar)
+		if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || len(avatar) > maxAvatarURLLength {
+			return "", errors.New("avatar_url must be an https URL")
+		}
+	}
+	return avatar, nil
+}
+
+// Normalize returns p with every field normalized, or the error of the first invalid one
+func (p UserProfile) Normalize() (UserProfile, error) {
+	var err error
+	if p.DisplayName, err = NormalizeDisplayName(p.DisplayName); err != nil {
+		return p, err
+	}
+	if p.Email, err = NormalizeEmail(p.Email); err != nil {
+		return p, err
+	}
+	if p.Locale, err = NormalizeLocale(p.Locale); err != nil {
+		return p, err
+	}
+	if p.AvatarURL, err = NormalizeAvatarURL(p.AvatarURL); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// e164Pattern matches an E.164 phone number: + and up to 15 digits, without a leading 0
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// NormalizePhone returns phone in E.164 form. Spaces, dashes, dots and parentheses are removed and
+// a leading 00 becomes +. Numbers without a country code get defaultCountryCode (digits only) in
+// place of their leading trunk 0, and are rejected if it is empty.
+func NormalizePhone(phone, defaultCountryCode string) (string, error) {
+	phone = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t-.()", r) {
+			return -1
+		}
+		return r
+	}, phone)
+
+	switch {
+	case phone == "":
+		return "", errors.New("phone is required")
+	case strings.HasPrefix(phone, "+"):
+	case strings.HasPrefix(phone, "00"):
+		phone = "+" + phone[2:]
+	case defaultCountryCode == "":
+		return "", errors.New("phone must start with + and a country code")
+	default:
+		phone = "+" + defaultCountryCode + strings.TrimPrefix(phone, "0")
+	}
+
+	if !e164Pattern.MatchString(phone) {
+		return "", errors.New("phone must be an E.164 number such as +989121234567")
+	}
+	return phone, nil
+}
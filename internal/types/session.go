@@ -0,0 +1,16 @@
+package types
+
+import "time"
+
+// Session is a device the user logged in from; tokens issued at login are bound to it
+// @Description Login session on a device
+type Session struct {
+	ID         uint64    `json:"id" example:"42" description:"Session identifier"`
+	UserID     uint64    `json:"-"`
+	DeviceName string    `json:"device_name" example:"Pixel 8" description:"Device name supplied at login"`
+	UserAgent  string    `json:"user_agent" example:"Mozilla/5.0 (Linux; Android 14)" description:"User agent of the login request"`
+	IPAddress  string    `json:"ip_address" example:"203.0.113.7" description:"IP address of the login request"`
+	CreatedAt  time.Time `json:"created_at" example:"2025-08-19T12:00:00Z" description:"Login time"`
+	LastSeenAt time.Time `json:"last_seen_at" example:"2025-08-19T12:30:00Z" description:"Last authenticated request"`
+	ExpiresAt  time.Time `json:"expires_at" example:"2025-08-20T12:00:00Z" description:"When tokens issued for this session expire"`
+}
@@ -0,0 +1,27 @@
+package types
+
+import "time"
+
+// TOTPEnrollment is a user's authenticator app registration
+type TOTPEnrollment struct {
+	UserID          uint64
+	SecretEncrypted []byte
+	ConfirmedAt     *time.Time
+	LastUsedStep    int64
+	CreatedAt       time.Time
+}
+
+// Confirmed reports whether the enrollment is active as a second factor
+func (e *TOTPEnrollment) Confirmed() bool {
+	return e.ConfirmedAt != nil
+}
+
+// MFAChallenge is a login that passed the SMS OTP and waits for the TOTP code
+type MFAChallenge struct {
+	UserID     uint64   `json:"user_id"`
+	ClientID   string   `json:"client_id,omitempty"`
+	Audience   []string `json:"audience"`
+	DeviceName string   `json:"device_name"`
+	// AuthRequestID is set for logins through /authorize; the challenge completes only that request
+	AuthRequestID string `json:"auth_request_id,omitempty"`
+}
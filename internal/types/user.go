@@ -3,9 +3,43 @@ package types
 import "time"
 
 // User represents a user in the system
-// @Description User entity with phone number and registration details
+// @Description User entity with phone number, profile and registration details
 type User struct {
-	ID        uint64    `json:"id" example:"1" description:"Unique user identifier"`
-	Phone     string    `json:"phone" example:"+1234567890" description:"User's phone number"`
-	CreatedAt time.Time `json:"created_at" example:"2025-08-19T12:00:00Z" description:"User registration timestamp"`
+	ID    uint64 `json:"id" example:"1" description:"Unique user identifier"`
+	Phone string `json:"phone" example:"+1234567890" description:"User's phone number"`
+	UserProfile
+	UserStatus
+	CreatedAt   time.Time  `json:"created_at" example:"2025-08-19T12:00:00Z" description:"User registration timestamp"`
+	UpdatedAt   time.Time  `json:"updated_at" example:"2025-08-19T12:00:00Z" description:"Last profile change, also exposed as the ETag of /me"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" example:"2025-08-19T12:00:00Z" description:"Last successful login"`
+	// DeletionScheduledAt is set while a requested account deletion is in its grace period
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" example:"2025-09-18T12:00:00Z" description:"When the account will be purged, unless the user logs in before"`
+	DeletedAt           *time.Time `json:"deleted_at,omitempty" example:"2025-09-18T12:00:00Z" description:"When the account was anonymized"`
+}
+
+// UserProfile holds the fields users edit about themselves; empty means unset
+type UserProfile struct {
+	DisplayName string `json:"display_name,omitempty" example:"Jane Doe" description:"Name shown to other users"`
+	Email       string `json:"email,omitempty" example:"jane@example.com" description:"Contact email address (not verified)"`
+	Locale      string `json:"locale,omitempty" example:"en-US" description:"Preferred BCP 47 language tag"`
+	AvatarURL   string `json:"avatar_url,omitempty" example:"https://cdn.example.com/avatars/1.png" description:"HTTPS URL of the profile picture"`
+}
+
+// Account statuses
+const (
+	UserStatusActive    = "active"
+	UserStatusBlocked   = "blocked"
+	UserStatusSuspended = "suspended"
+)
+
+// UserStatus tells whether the user may log in. Blocks last until lifted; suspensions end at StatusExpiresAt.
+type UserStatus struct {
+	Status          string     `json:"status" example:"active" enums:"active,blocked,suspended" description:"Account status"`
+	StatusReason    string     `json:"status_reason,omitempty" example:"Spam reports" description:"Why the account was blocked or suspended"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty" example:"2025-08-26T12:00:00Z" description:"When a suspension ends"`
+}
+
+// Restricted reports whether the user is currently blocked or suspended
+func (s UserStatus) Restricted(now time.Time) bool {
+	return s.Status != UserStatusActive && (s.StatusExpiresAt == nil || now.Before(*s.StatusExpiresAt))
 }
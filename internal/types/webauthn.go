@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+// WebAuthnCredential is a passkey registered by a user
+// @Description Registered passkey
+type WebAuthnCredential struct {
+	ID           uint64     `json:"id" example:"3" description:"Passkey identifier"`
+	UserID       uint64     `json:"-"`
+	CredentialID []byte     `json:"-"`
+	PublicKey    []byte     `json:"-"`
+	SignCount    uint32     `json:"-"`
+	Name         string     `json:"name" example:"MacBook" description:"Name chosen at registration"`
+	Transports   []string   `json:"transports" example:"internal,hybrid" description:"Transports reported by the authenticator"`
+	CreatedAt    time.Time  `json:"created_at" example:"2025-08-19T12:00:00Z" description:"Registration time"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty" example:"2025-08-19T12:30:00Z" description:"Last successful login"`
+}
+
+// WebAuthn ceremonies a challenge can be used for
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+)
+
+// WebAuthnChallenge is the server-side state of a pending passkey ceremony
+type WebAuthnChallenge struct {
+	Ceremony string `json:"ceremony"`
+	// UserID is the user registering a passkey; logins learn the user from the credential
+	UserID   uint64   `json:"user_id,omitempty"`
+	ClientID string   `json:"client_id,omitempty"`
+	Audience []string `json:"audience,omitempty"`
+}
@@ -0,0 +1,316 @@
+// Package userimport creates users in bulk from CSV or NDJSON files exported by other systems.
+// It is shared by the import endpoint and the import command.
+package userimport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/MiladJlz/dekamond-task/internal/db"
+	"github.com/MiladJlz/dekamond-task/internal/types"
+)
+
+// DefaultBatchSize is how many rows are loaded per COPY when Options.BatchSize is 0
+const DefaultBatchSize = 1000
+
+// maxLineLength bounds a single NDJSON line
+const maxLineLength = 64 * 1024
+
+// ErrInvalidFile is wrapped by the errors for files that cannot be read as a whole, such as an
+// unknown CSV column
+var ErrInvalidFile = errors.New("invalid import file")
+
+// Row outcomes
+const (
+	StatusCreated = "created"
+	StatusSkipped = "skipped"
+	StatusInvalid = "invalid"
+)
+
+// Options configures an import
+type Options struct {
+	// Format is csv or ndjson
+	Format string
+	// DefaultCountryCode is given to phone numbers without one, digits only (e.g. "98"); when
+	// empty such numbers are invalid
+	DefaultCountryCode string
+	BatchSize          int
+}
+
+// Result is the outcome of one row of the file
+type Result struct {
+	// Line is the row's line in the file; the CSV header is line 1
+	Line   int    `json:"line" example:"2" description:"Line of the row in the file"`
+	Phone  string `json:"phone,omitempty" example:"+989121234567" description:"Normalized phone number, or as given when it is invalid"`
+	Status string `json:"status" example:"created" enums:"created,skipped,invalid" description:"What happened to the row"`
+	UserID uint64 `json:"user_id,omitempty" example:"42" description:"ID of the created user"`
+	Reason string `json:"reason,omitempty" example:"phone already registered" description:"Why the row was skipped or is invalid"`
+}
+
+// Summary counts the rows of an import by outcome
+type Summary struct {
+	Created int `json:"created" example:"980" description:"Users created"`
+	Skipped int `json:"skipped" example:"15" description:"Rows whose phone was already registered or repeated in the file"`
+	Invalid int `json:"invalid" example:"5" description:"Rows that failed validation"`
+}
+
+// record is a row as read from the file, before validation
+type record struct {
+	Phone       string `json:"phone"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Locale      string `json:"locale"`
+	AvatarURL   string `json:"avatar_url"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// csvColumns are the accepted CSV header names; phone is required
+var csvColumns = map[string]func(r *record) *string{
+	"phone":        func(r *record) *string { return &r.Phone },
+	"display_name": func(r *record) *string { return &r.DisplayName },
+	"email":        func(r *record) *string { return &r.Email },
+	"locale":       func(r *record) *string { return &r.Locale },
+	"avatar_url":   func(r *record) *string { return &r.AvatarURL },
+	"created_at":   func(r *record) *string { return &r.CreatedAt },
+}
+
+// Import reads users from src and creates those whose phone is not registered yet, in batches.
+// report is called once per row, in file order, as each batch completes. Batches that completed
+// stay imported when a later one fails, so a failed import can simply be run again.
+func Import(ctx context.Context, store db.UserRepository, src io.Reader, opts Options, report func(Result) error) (Summary, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	var next func() (int, *record, error)
+	switch opts.Format {
+	case "csv":
+		var err error
+		if next, err = csvRecords(src); err != nil {
+			return Summary{}, err
+		}
+	case "ndjson":
+		next = ndjsonRecords(src)
+	default:
+		return Summary{}, fmt.Errorf("%w: format must be csv or ndjson", ErrInvalidFile)
+	}
+
+	b := &batch{store: store, report: report, firstLine: map[string]int{}}
+	for {
+		if err := ctx.Err(); err != nil {
+			return b.summary, err
+		}
+		line, rec, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			b.add(Result{Line: line, Status: StatusInvalid, Reason: rowErr.reason}, nil)
+		} else if err != nil {
+			return b.summary, err
+		} else {
+			b.add(validate(line, rec, opts.DefaultCountryCode))
+		}
+
+		if len(b.results) >= opts.BatchSize {
+			if err := b.flush(); err != nil {
+				return b.summary, err
+			}
+		}
+	}
+	return b.summary, b.flush()
+}
+
+// rowError is a row that cannot be read; the rows after it still can
+type rowError struct {
+	reason string
+}
+
+func (e *rowError) Error() string { return e.reason }
+
+// validate normalizes rec into a user, or returns an invalid result
+func validate(line int, rec *record, defaultCountryCode string) (Result, *db.ImportUser) {
+	result := Result{Line: line, Phone: rec.Phone, Status: StatusInvalid}
+
+	phone, err := types.NormalizePhone(rec.Phone, defaultCountryCode)
+	if err != nil {
+		result.Reason = err.Error()
+		return result, nil
+	}
+	result.Phone = phone
+
+	user := &db.ImportUser{Phone: phone}
+	user.Profile, err = types.UserProfile{
+		DisplayName: rec.DisplayName,
+		Email:       rec.Email,
+		Locale:      rec.Locale,
+		AvatarURL:   rec.AvatarURL,
+	}.Normalize()
+	if err != nil {
+		result.Reason = err.Error()
+		return result, nil
+	}
+
+	if v := strings.TrimSpace(rec.CreatedAt); v != "" {
+		if user.CreatedAt, err = time.Parse(time.RFC3339, v); err != nil {
+			result.Reason = "created_at must be an RFC 3339 timestamp"
+			return result, nil
+		}
+		if user.CreatedAt.After(time.Now()) {
+			result.Reason = "created_at must not be in the future"
+			return result, nil
+		}
+	}
+
+	result.Status = ""
+	return result, user
+}
+
+// batch holds the rows read since the last flush, in file order
+type batch struct {
+	store   db.UserRepository
+	report  func(Result) error
+	summary Summary
+
+	results []Result
+	users   []db.ImportUser
+	// firstLine is the line each phone of the batch first appeared on
+	firstLine map[string]int
+}
+
+// add queues the result of a row; user is nil for rows that are already decided
+func (b *batch) add(result Result, user *db.ImportUser) {
+	if user != nil {
+		if line, ok := b.firstLine[user.Phone]; ok {
+			result.Status, result.Reason = StatusSkipped, fmt.Sprintf("duplicate of line %d", line)
+			user = nil
+		} else {
+			b.firstLine[user.Phone] = result.Line
+			b.users = append(b.users, *user)
+		}
+	}
+	b.results = append(b.results, result)
+}
+
+// flush imports the queued users and reports every queued row
+func (b *batch) flush() error {
+	var created map[string]uint64
+	if len(b.users) > 0 {
+		var err error
+		if created, err = b.store.ImportUsers(b.users); err != nil {
+			return err
+		}
+	}
+
+	for _, result := range b.results {
+		if result.Status == "" {
+			if id, ok := created[result.Phone]; ok {
+				result.Status, result.UserID = StatusCreated, id
+			} else {
+				result.Status, result.Reason = StatusSkipped, "phone already registered"
+			}
+		}
+		switch result.Status {
+		case StatusCreated:
+			b.summary.Created++
+		case StatusSkipped:
+			b.summary.Skipped++
+		case StatusInvalid:
+			b.summary.Invalid++
+		}
+		if err := b.report(result); err != nil {
+			return err
+		}
+	}
+
+	b.results, b.users = b.results[:0], b.users[:0]
+	clear(b.firstLine)
+	return nil
+}
+
+// csvRecords reads the header of src and returns a reader of the rows after it
+func csvRecords(src io.Reader) (func() (int, *record, error), error) {
+	r := csv.NewReader(src)
+	r.TrimLeadingSpace = true
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.Is(err, io.EOF) || errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("%w: cannot read csv header: %v", ErrInvalidFile, err)
+		}
+		return nil, err
+	}
+	fields := make([]func(*record) *string, len(header))
+	hasPhone := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		field, ok := csvColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown csv column %q; expected phone, display_name, email, locale, avatar_url and created_at", ErrInvalidFile, name)
+		}
+		fields[i] = field
+		hasPhone = hasPhone || name == "phone"
+	}
+	if !hasPhone {
+		return nil, fmt.Errorf("%w: csv header has no phone column", ErrInvalidFile)
+	}
+
+	return func() (int, *record, error) {
+		values, err := r.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return parseErr.StartLine, nil, &rowError{reason: parseErr.Err.Error()}
+			}
+			return 0, nil, err
+		}
+		line, _ := r.FieldPos(0)
+		rec := &record{}
+		for i, v := range values {
+			*fields[i](rec) = v
+		}
+		return line, rec, nil
+	}, nil
+}
+
+// ndjsonRecords returns a reader of the JSON objects of src, one per line; blank lines are skipped
+func ndjsonRecords(src io.Reader) func() (int, *record, error) {
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineLength)
+	line := 0
+
+	return func() (int, *record, error) {
+		for scanner.Scan() {
+			line++
+			raw := bytes.TrimSpace(scanner.Bytes())
+			if len(raw) == 0 {
+				continue
+			}
+
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.DisallowUnknownFields()
+			rec := &record{}
+			if err := dec.Decode(rec); err != nil {
+				return line, nil, &rowError{reason: "invalid JSON object: " + err.Error()}
+			}
+			return line, rec, nil
+		}
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return line + 1, nil, fmt.Errorf("%w: line %d is longer than %d bytes", ErrInvalidFile, line+1, maxLineLength)
+			}
+			return line, nil, err
+		}
+		return line, nil, io.EOF
+	}
+}
@@ -0,0 +1,161 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encodeCBOR encodes the subset of values decodeCBOR produces, for building test inputs
+func encodeCBOR(v any) []byte {
+	head := func(major byte, arg uint64) []byte {
+		switch {
+		case arg < 24:
+			return []byte{major<<5 | byte(arg)}
+		case arg <= 0xff:
+			return []byte{major<<5 | 24, byte(arg)}
+		case arg <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+		case arg <= 0xffffffff:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+		}
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, arg)
+	}
+
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []any:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case map[any]any:
+		out := head(5, uint64(len(v)))
+		for key, value := range v {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(value)...)
+		}
+		return out
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want any
+		rest string
+	}{
+		{"small int", "17", int64(23), ""},
+		{"uint8", "18 64", int64(100), ""},
+		{"uint16", "19 03e8", int64(1000), ""},
+		{"uint64", "1b 7fffffffffffffff", int64(1<<63 - 1), ""},
+		{"negative", "20", int64(-1), ""},
+		{"negative uint16", "39 0100", int64(-257), ""},
+		{"byte string", "43 010203", []byte{1, 2, 3}, ""},
+		{"text string", "63 616263", "abc", ""},
+		{"array", "82 01 61 61", []any{int64(1), "a"}, ""},
+		{"map", "a2 01 02 61 61 f5", map[any]any{int64(1): int64(2), "a": true}, ""},
+		{"false", "f4", false, ""},
+		{"null", "f6", nil, ""},
+		{"trailing data is returned", "01 02 03", int64(1), "0203"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := decodeCBOR(mustHex(t, tt.in))
+			if err != nil {
+				t.Fatalf("decodeCBOR(%s): %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCBOR(%s) = %#v, want %#v", tt.in, got, tt.want)
+			}
+			if hex.EncodeToString(rest) != tt.rest {
+				t.Errorf("decodeCBOR(%s) left %x, want %s", tt.in, rest, tt.rest)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"truncated uint8 argument", "18"},
+		{"truncated uint16 argument", "19 03"},
+		{"truncated uint32 argument", "1a 0000"},
+		{"truncated uint64 argument", "1b 00000000000000"},
+		{"truncated byte string", "43 0102"},
+		{"truncated text string", "63 6162"},
+		{"truncated array", "82 01"},
+		{"truncated map value", "a1 01"},
+		{"over-long byte string", "5b ffffffffffffffff 00"},
+		{"over-long text string", "7a ffffffff 61"},
+		{"over-long array", "9b ffffffffffffffff 00"},
+		{"over-long map", "bb ffffffffffffffff 00"},
+		{"integer overflow", "1b 8000000000000000"},
+		{"negative integer overflow", "3b 8000000000000000"},
+		{"indefinite length", "5f 41 00 ff"},
+		{"reserved additional info", "1c"},
+		{"byte string map key", "a1 40 00"},
+		{"bool map key", "a1 f5 00"},
+		{"array map key", "a1 80 00"},
+		{"map map key", "a1 a0 00"},
+		{"tag", "c1 00"},
+		{"float", "f9 3c00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _, err := decodeCBOR(mustHex(t, tt.in)); err == nil {
+				t.Errorf("decodeCBOR(%s) = %#v, want an error", tt.in, got)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORNestingLimit(t *testing.T) {
+	nested := func(depth int) []byte {
+		return mustHex(t, strings.Repeat("81", depth)+"00")
+	}
+
+	if _, _, err := decodeCBOR(nested(maxCBORDepth)); err != nil {
+		t.Errorf("%d nested arrays: %v", maxCBORDepth, err)
+	}
+	if _, _, err := decodeCBOR(nested(maxCBORDepth + 1)); err == nil {
+		t.Errorf("%d nested arrays decoded, want an error", maxCBORDepth+1)
+	}
+	if _, _, err := decodeCBOR(mustHex(t, strings.Repeat("a1 01", maxCBORDepth+1)+"00")); err == nil {
+		t.Errorf("%d nested maps decoded, want an error", maxCBORDepth+1)
+	}
+}
@@ -0,0 +1,113 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers accepted for credentials, in order of preference
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKty = 1
+	coseAlg = 3
+	// coseCrv is the curve for EC2/OKP keys and the modulus for RSA keys
+	coseCrv = -1
+	// coseX is the x coordinate for EC2/OKP keys and the exponent for RSA keys
+	coseX = -2
+	coseY = -3
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// publicKey is a parsed COSE credential public key
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey parses a COSE_Key as stored with a credential
+func parsePublicKey(cose []byte) (*publicKey, error) {
+	decoded, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after public key")
+	}
+	m, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("public key is not a map")
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	crv, _ := m[int64(coseCrv)].(int64)
+	x, _ := m[int64(coseX)].([]byte)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256 && crv == coseCrvP256:
+		y, _ := m[int64(coseY)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 coordinates")
+		}
+		key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, err
+		}
+		return &publicKey{alg: alg, key: key}, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA && crv == coseCrvEd25519:
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseCrv)].([]byte)
+		e, _ := m[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		// An exponent of 1 makes every message its own signature; RSA exponents are odd and at least 3
+		exponent := new(big.Int).SetBytes(e).Int64()
+		if exponent < 3 || exponent%2 == 0 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent)}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %d with algorithm %d", kty, alg)
+}
+
+// verify checks an assertion signature over signed
+func (k *publicKey) verify(signed, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, signed, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
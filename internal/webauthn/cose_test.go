@@ -0,0 +1,164 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+// testKey is a credential key pair with its COSE encoding
+type testKey struct {
+	cose map[any]any
+	sign func(t *testing.T, signed []byte) []byte
+}
+
+func newES256Key(t *testing.T) testKey {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{
+		cose: map[any]any{
+			int64(coseKty): int64(coseKtyEC2),
+			int64(coseAlg): int64(AlgES256),
+			int64(coseCrv): int64(coseCrvP256),
+			int64(coseX):   priv.X.FillBytes(make([]byte, 32)),
+			int64(coseY):   priv.Y.FillBytes(make([]byte, 32)),
+		},
+		sign: func(t *testing.T, signed []byte) []byte {
+			digest := sha256.Sum256(signed)
+			sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		},
+	}
+}
+
+func newEdDSAKey(t *testing.T) testKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{
+		cose: map[any]any{
+			int64(coseKty): int64(coseKtyOKP),
+			int64(coseAlg): int64(AlgEdDSA),
+			int64(coseCrv): int64(coseCrvEd25519),
+			int64(coseX):   []byte(pub),
+		},
+		sign: func(t *testing.T, signed []byte) []byte {
+			return ed25519.Sign(priv, signed)
+		},
+	}
+}
+
+func newRS256Key(t *testing.T) testKey {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{
+		cose: map[any]any{
+			int64(coseKty): int64(coseKtyRSA),
+			int64(coseAlg): int64(AlgRS256),
+			int64(coseCrv): priv.N.Bytes(),
+			int64(coseX):   big.NewInt(int64(priv.E)).Bytes(),
+		},
+		sign: func(t *testing.T, signed []byte) []byte {
+			digest := sha256.Sum256(signed)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		},
+	}
+}
+
+// with returns a copy of the COSE key with field set to value, or removed if value is nil
+func (k testKey) with(field int64, value any) []byte {
+	m := make(map[any]any, len(k.cose))
+	for key, v := range k.cose {
+		m[key] = v
+	}
+	if value == nil {
+		delete(m, field)
+	} else {
+		m[field] = value
+	}
+	return encodeCBOR(m)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	keys := map[string]testKey{
+		"ES256": newES256Key(t),
+		"EdDSA": newEdDSAKey(t),
+		"RS256": newRS256Key(t),
+	}
+	for name, key := range keys {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := parsePublicKey(encodeCBOR(key.cose))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.alg != key.cose[int64(coseAlg)] {
+				t.Errorf("alg = %d, want %d", parsed.alg, key.cose[int64(coseAlg)])
+			}
+
+			signed := []byte("authenticator data and client data hash")
+			if !parsed.verify(signed, key.sign(t, signed)) {
+				t.Error("valid signature rejected")
+			}
+			if parsed.verify([]byte("something else"), key.sign(t, signed)) {
+				t.Error("signature over other data accepted")
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyRejects(t *testing.T) {
+	es256, eddsa, rs256 := newES256Key(t), newEdDSAKey(t), newRS256Key(t)
+	modulus := rs256.cose[int64(coseCrv)].([]byte)
+
+	tests := []struct {
+		name string
+		cose []byte
+	}{
+		{"not a map", encodeCBOR([]any{int64(1)})},
+		{"trailing data", append(encodeCBOR(es256.cose), 0x00)},
+		{"truncated", encodeCBOR(es256.cose)[:20]},
+		{"unknown key type", es256.with(coseKty, int64(4))},
+		{"unsupported algorithm", es256.with(coseAlg, int64(-35))},
+		{"ES256 on another curve", es256.with(coseCrv, int64(2))},
+		{"ES256 short x", es256.with(coseX, make([]byte, 31))},
+		{"ES256 missing y", es256.with(coseY, nil)},
+		{"ES256 point not on curve", es256.with(coseY, make([]byte, 32))},
+		{"EdDSA on another curve", eddsa.with(coseCrv, int64(7))},
+		{"EdDSA short key", eddsa.with(coseX, make([]byte, 31))},
+		{"EdDSA key type with ES256", eddsa.with(coseAlg, int64(AlgES256))},
+		{"RS256 short modulus", rs256.with(coseCrv, modulus[:255])},
+		{"RS256 missing exponent", rs256.with(coseX, nil)},
+		{"RS256 long exponent", rs256.with(coseX, []byte{1, 0, 0, 0, 1})},
+		{"RS256 exponent 1", rs256.with(coseX, []byte{1})},
+		{"RS256 exponent 0", rs256.with(coseX, []byte{0})},
+		{"RS256 even exponent", rs256.with(coseX, []byte{1, 0, 0})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if key, err := parsePublicKey(tt.cose); err == nil {
+				t.Errorf("parsePublicKey = %+v, want an error", key)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Package webauthn implements the relying party side of WebAuthn registration and
+// authentication ceremonies for passkeys. Attestation statements are not verified: the
+// service asks for "none" attestation and trusts any authenticator the user chooses.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidResponse is wrapped by all errors caused by a malformed or failed ceremony response
+var ErrInvalidResponse = errors.New("invalid webauthn response")
+
+// Authenticator data flags (WebAuthn §6.1)
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// RelyingParty identifies this service to authenticators
+type RelyingParty struct {
+	// ID is the domain credentials are scoped to, e.g. "example.com"
+	ID   string
+	Name string
+	// Origins are the exact web origins allowed to run ceremonies, e.g. "https://app.example.com"
+	Origins []string
+}
+
+// URLEncodedBytes is binary data carried as unpadded base64url in JSON, as browsers serialize it
+type URLEncodedBytes []byte
+
+func (b URLEncodedBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// UserEntity describes the account a credential is created for
+type UserEntity struct {
+	ID          URLEncodedBytes `json:"id" swaggertype:"string"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"displayName"`
+}
+
+// CredentialDescriptor references an existing credential
+type CredentialDescriptor struct {
+	Type       string          `json:"type"`
+	ID         URLEncodedBytes `json:"id" swaggertype:"string"`
+	Transports []string        `json:"transports,omitempty"`
+}
+
+// CredentialParameter is an acceptable public key algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// RelyingPartyEntity is the relying party as presented to the authenticator
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// AuthenticatorSelection states requirements for the authenticator creating a credential
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the publicKey options for navigator.credentials.create()
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the publicKey options for navigator.credentials.get(). Allowed credentials
+// are left empty so the authenticator offers its discoverable credentials (passkeys).
+type RequestOptions struct {
+	Challenge        string `json:"challenge"`
+	RPID             string `json:"rpId"`
+	Timeout          int64  `json:"timeout"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions builds registration options for user. challenge must be base64url encoded
+// and exclude lists credentials the user already has so the same authenticator is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge string, user UserEntity, exclude []CredentialDescriptor, timeout time.Duration) CreationOptions {
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:      user,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds authentication options; challenge must be base64url encoded
+func (rp *RelyingParty) RequestOptions(challenge string, timeout time.Duration) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          timeout.Milliseconds(),
+		UserVerification: "required",
+	}
+}
+
+// RegistrationResponse is the JSON serialization of the PublicKeyCredential returned by create()
+type RegistrationResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId" swaggertype:"string"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON" swaggertype:"string"`
+		AttestationObject URLEncodedBytes `json:"attestationObject" swaggertype:"string"`
+		Transports        []string        `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON serialization of the PublicKeyCredential returned by get()
+type AssertionResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId" swaggertype:"string"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON" swaggertype:"string"`
+		AuthenticatorData URLEncodedBytes `json:"authenticatorData" swaggertype:"string"`
+		Signature         URLEncodedBytes `json:"signature" swaggertype:"string"`
+		UserHandle        URLEncodedBytes `json:"userHandle,omitempty" swaggertype:"string"`
+	} `json:"response"`
+}
+
+// ClientData is the collected client data signed over by the authenticator
+type ClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// ParseClientData decodes clientDataJSON, e.g. to find the challenge a response answers
+func ParseClientData(raw []byte) (*ClientData, error) {
+	var cd ClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, fmt.Errorf("%w: client data: %w", ErrInvalidResponse, err)
+	}
+	if cd.Challenge == "" {
+		return nil, fmt.Errorf("%w: client data has no challenge", ErrInvalidResponse)
+	}
+	return &cd, nil
+}
+
+// Credential is a newly registered public key credential
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE encoded credential public key
+	PublicKey  []byte
+	SignCount  uint32
+	Transports []string
+}
+
+// VerifyRegistration checks a create() response against the challenge that was issued
+// and returns the credential to store (WebAuthn §7.1)
+func (rp *RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge string) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", ErrInvalidResponse, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %w", ErrInvalidResponse, err)
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrInvalidResponse)
+	}
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidResponse)
+	}
+	if !bytes.Equal(authData.credentialID, resp.RawID) {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrInvalidResponse)
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	return &Credential{
+		ID:         authData.credentialID,
+		PublicKey:  authData.publicKey,
+		SignCount:  authData.signCount,
+		Transports: resp.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion checks a get() response against the issued challenge and the stored credential
+// public key, and returns the authenticator's new signature counter (WebAuthn §7.2). Callers must
+// ensure the credential belongs to the user identified by the response's user handle.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge string, cosePublicKey []byte, storedSignCount uint32) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, fmt.Errorf("%w: unexpected credential type %q", ErrInvalidResponse, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(cosePublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("stored public key: %w", err)
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := slices.Concat([]byte(resp.Response.AuthenticatorData), clientDataHash[:])
+	if !key.verify(signed, resp.Response.Signature) {
+		return 0, fmt.Errorf("%w: bad signature", ErrInvalidResponse)
+	}
+
+	// Synced passkeys always report 0; otherwise a counter that did not grow suggests a cloned authenticator
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, fmt.Errorf("%w: signature counter did not increase", ErrInvalidResponse)
+	}
+	return authData.signCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony, challenge string) error {
+	cd, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrInvalidResponse, cd.Type)
+	}
+	if cd.Challenge != challenge {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("%w: origin %q not allowed", ErrInvalidResponse, cd.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData decodes authenticator data and checks the RP ID hash and that the
+// user was present and verified
+func (rp *RelyingParty) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: rp id hash mismatch", ErrInvalidResponse)
+	}
+
+	ad := &authenticatorData{flags: data[32], signCount: binary.BigEndian.Uint32(data[33:37])}
+	if ad.flags&flagUserPresent == 0 || ad.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user not present or not verified", ErrInvalidResponse)
+	}
+
+	if ad.flags&flagAttestedCredData != 0 {
+		// aaguid (16) | credential id length (2) | credential id | COSE public key
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+			return nil, fmt.Errorf("%w: invalid credential id", ErrInvalidResponse)
+		}
+		ad.credentialID = rest[:idLen:idLen]
+
+		_, extensions, err := decodeCBOR(rest[idLen:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: credential public key: %w", ErrInvalidResponse, err)
+		}
+		keyLen := len(rest) - idLen - len(extensions)
+		ad.publicKey = rest[idLen : idLen+keyLen : idLen+keyLen]
+	}
+
+	return ad, nil
+}
@@ -0,0 +1,135 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+const testChallenge = "c2lnbi1pbi1jaGFsbGVuZ2U"
+
+var testRP = &RelyingParty{ID: "example.com", Name: "Example", Origins: []string{"https://example.com"}}
+
+// assertion describes a get() response; zero fields take the values of a valid one
+type assertion struct {
+	typ       string
+	clientTyp string
+	challenge string
+	origin    string
+	rpID      string
+	flags     byte
+	signCount uint32
+	// tamper changes the authenticator data after it was signed
+	tamper bool
+}
+
+func (a assertion) response(t *testing.T, key testKey) *AssertionResponse {
+	t.Helper()
+	orDefault := func(v, def string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	}
+
+	clientData, err := json.Marshal(ClientData{
+		Type:      orDefault(a.clientTyp, "webauthn.get"),
+		Challenge: orDefault(a.challenge, testChallenge),
+		Origin:    orDefault(a.origin, testRP.Origins[0]),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpIDHash := sha256.Sum256([]byte(orDefault(a.rpID, testRP.ID)))
+	flags := a.flags
+	if flags == 0 {
+		flags = flagUserPresent | flagUserVerified
+	}
+	authData := binary.BigEndian.AppendUint32(append(rpIDHash[:], flags), a.signCount)
+
+	clientDataHash := sha256.Sum256(clientData)
+	signature := key.sign(t, slices.Concat(authData, clientDataHash[:]))
+	if a.tamper {
+		authData[len(authData)-1]++
+	}
+
+	resp := &AssertionResponse{Type: orDefault(a.typ, "public-key")}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = signature
+	return resp
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	for name, key := range map[string]testKey{"ES256": newES256Key(t), "EdDSA": newEdDSAKey(t), "RS256": newRS256Key(t)} {
+		t.Run(name, func(t *testing.T) {
+			count, err := testRP.VerifyAssertion(assertion{signCount: 8}.response(t, key), testChallenge, encodeCBOR(key.cose), 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 8 {
+				t.Errorf("sign count = %d, want 8", count)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionSyncedPasskey(t *testing.T) {
+	key := newES256Key(t)
+	// Synced passkeys keep reporting 0
+	count, err := testRP.VerifyAssertion(assertion{}.response(t, key), testChallenge, encodeCBOR(key.cose), 0)
+	if err != nil || count != 0 {
+		t.Fatalf("VerifyAssertion = %d, %v, want 0 and no error", count, err)
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	key := newES256Key(t)
+	other := newES256Key(t)
+
+	tests := []struct {
+		name      string
+		assertion assertion
+		stored    uint32
+		publicKey []byte
+	}{
+		{name: "credential type", assertion: assertion{typ: "password"}},
+		{name: "ceremony type", assertion: assertion{clientTyp: "webauthn.create"}},
+		{name: "challenge mismatch", assertion: assertion{challenge: "b3RoZXI"}},
+		{name: "origin not allowed", assertion: assertion{origin: "https://evil.example"}},
+		{name: "rp id hash mismatch", assertion: assertion{rpID: "evil.example"}},
+		{name: "user not verified", assertion: assertion{flags: flagUserPresent}},
+		{name: "user not present", assertion: assertion{flags: flagUserVerified}},
+		{name: "tampered authenticator data", assertion: assertion{signCount: 3, tamper: true}},
+		{name: "signed by another key", publicKey: encodeCBOR(other.cose)},
+		{name: "sign count regression", assertion: assertion{signCount: 5}, stored: 10},
+		{name: "sign count repeated", assertion: assertion{signCount: 10}, stored: 10},
+		{name: "sign count reset to 0", assertion: assertion{signCount: 0}, stored: 10},
+		{name: "unparsable stored key", publicKey: []byte{0xa1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publicKey := tt.publicKey
+			if publicKey == nil {
+				publicKey = encodeCBOR(key.cose)
+			}
+			if _, err := testRP.VerifyAssertion(tt.assertion.response(t, key), testChallenge, publicKey, tt.stored); err == nil {
+				t.Error("VerifyAssertion succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionShortAuthenticatorData(t *testing.T) {
+	key := newES256Key(t)
+	resp := assertion{}.response(t, key)
+	resp.Response.AuthenticatorData = resp.Response.AuthenticatorData[:36]
+
+	_, err := testRP.VerifyAssertion(resp, testChallenge, encodeCBOR(key.cose), 0)
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("VerifyAssertion error = %v, want ErrInvalidResponse", err)
+	}
+}
@@ -1,6 +1,3 @@
-
-\connect dekamond
-
 -- Create users table
 CREATE TABLE users (
     id BIGSERIAL PRIMARY KEY,
@@ -0,0 +1,10 @@
+-- Create OAuth/OIDC client registrations
+CREATE TABLE oauth_clients (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    -- NULL for public clients, which must use PKCE without a secret
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    audiences TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
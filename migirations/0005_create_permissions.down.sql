@@ -0,0 +1,4 @@
+ALTER TABLE role_permissions DROP CONSTRAINT role_permissions_permission_fkey;
+
+-- The admin role and its grants are kept; the role may have existed before this migration
+DROP TABLE permissions;
@@ -0,0 +1,28 @@
+-- Create permissions catalog
+CREATE TABLE permissions (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:list', 'List and search all users'),
+    ('users:read', 'Read any user record'),
+    ('roles:write', 'Grant and revoke user roles'),
+    ('clients:write', 'Register OIDC clients');
+
+-- Keep permissions that were granted before the catalog existed
+INSERT INTO permissions (name)
+SELECT DISTINCT permission FROM role_permissions
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE role_permissions
+    ADD CONSTRAINT role_permissions_permission_fkey
+    FOREIGN KEY (permission) REFERENCES permissions(name) ON DELETE CASCADE;
+
+-- Seed the admin role with every permission
+INSERT INTO roles (name, description) VALUES ('admin', 'Full access to user management')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+DROP TABLE api_keys;
+
+DELETE FROM role_permissions WHERE permission = 'api_keys:write';
+DELETE FROM permissions WHERE name = 'api_keys:write';
@@ -0,0 +1,10 @@
+-- Create TOTP authenticator enrollments; the secret is encrypted by the application
+CREATE TABLE user_totp (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret_encrypted BYTEA NOT NULL,
+    -- NULL until the user confirms the enrollment with a valid code
+    confirmed_at TIMESTAMPTZ,
+    -- Last accepted RFC 6238 time step, used to reject replayed codes
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+DROP TABLE impersonation_log;
+
+DELETE FROM role_permissions WHERE permission = 'users:impersonate';
+DELETE FROM permissions WHERE name = 'users:impersonate';
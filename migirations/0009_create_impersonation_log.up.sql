@@ -0,0 +1,22 @@
+-- Create the audit log of support staff impersonating users
+CREATE TABLE impersonation_log (
+    id BIGSERIAL PRIMARY KEY,
+    -- Kept when either user is deleted so the trail survives
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    target_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    -- jti of the issued token, to revoke it or correlate requests made with it
+    token_id TEXT NOT NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_impersonation_log_target_id ON impersonation_log(target_id);
+
+INSERT INTO permissions (name, description) VALUES ('users:impersonate', 'Act as another user for support')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'users:impersonate')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    DROP COLUMN display_name,
+    DROP COLUMN email,
+    DROP COLUMN locale,
+    DROP COLUMN avatar_url,
+    DROP COLUMN updated_at;
@@ -0,0 +1,8 @@
+-- Add self-service profile fields; empty strings mean unset
+ALTER TABLE users
+    ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN email TEXT NOT NULL DEFAULT '',
+    ADD COLUMN locale TEXT NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '',
+    -- Bumped on every profile change; used for optimistic concurrency
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,8 @@
+-- Self-service account deletion: accounts are purged once the grace period has passed
+ALTER TABLE users
+    ADD COLUMN deletion_scheduled_at TIMESTAMPTZ,
+    -- Set when the purge job anonymizes the row instead of deleting it
+    ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Add index for the purge job picking due accounts
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
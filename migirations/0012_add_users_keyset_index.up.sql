@@ -0,0 +1,5 @@
+-- Replace the created_at index with one matching the keyset pagination order,
+-- so (created_at, id) < (...) seeks instead of scanning
+CREATE INDEX idx_users_created_at_id ON users(created_at DESC, id DESC);
+
+DROP INDEX idx_users_created_at;
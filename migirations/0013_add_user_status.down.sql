@@ -0,0 +1,9 @@
+DELETE FROM role_permissions WHERE permission = 'users:block';
+DELETE FROM permissions WHERE name = 'users:block';
+
+DROP INDEX idx_users_status;
+
+ALTER TABLE users
+    DROP COLUMN status,
+    DROP COLUMN status_reason,
+    DROP COLUMN status_expires_at;
@@ -0,0 +1,14 @@
+-- Account status; suspensions end at status_expires_at, blocks last until lifted
+ALTER TABLE users
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'blocked', 'suspended')),
+    ADD COLUMN status_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN status_expires_at TIMESTAMPTZ;
+
+-- Add index for listing restricted accounts
+CREATE INDEX idx_users_status ON users(status) WHERE status <> 'active';
+
+INSERT INTO permissions (name, description) VALUES ('users:block', 'Block, suspend and unblock users')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'users:block')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN last_login_at;
+
+DROP TABLE login_events;
@@ -0,0 +1,17 @@
+-- Login history: one row per login attempt, successful or not
+CREATE TABLE login_events (
+    id BIGSERIAL PRIMARY KEY,
+    -- NULL for attempts on phone numbers without an account
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    phone TEXT NOT NULL DEFAULT '',
+    method TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Add index for listing a user's history, newest first
+CREATE INDEX idx_login_events_user_id ON login_events(user_id, id DESC);
+
+ALTER TABLE users ADD COLUMN last_login_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+DELETE FROM role_permissions WHERE permission = 'audit:read';
+DELETE FROM permissions WHERE name = 'audit:read';
+
+DROP TABLE audit_log;
+DROP FUNCTION audit_log_append_only();
@@ -0,0 +1,37 @@
+-- Create the tamper-evident audit log. Rows are chained by hash and never change; user IDs are
+-- plain columns without foreign keys so entries outlive the accounts they mention.
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    action TEXT NOT NULL,
+    actor_user_id BIGINT NOT NULL DEFAULT 0,
+    actor_api_key_id BIGINT NOT NULL DEFAULT 0,
+    target_user_id BIGINT NOT NULL DEFAULT 0,
+    ip_address TEXT NOT NULL DEFAULT '',
+    -- JSON rather than JSONB keeps the exact text the hash was computed over
+    details JSON NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX idx_audit_log_action ON audit_log(action, id);
+CREATE INDEX idx_audit_log_actor_user_id ON audit_log(actor_user_id, id) WHERE actor_user_id <> 0;
+CREATE INDEX idx_audit_log_target_user_id ON audit_log(target_user_id, id) WHERE target_user_id <> 0;
+
+-- Reject changes to existing entries; the hash chain catches anyone who bypasses this
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+INSERT INTO permissions (name, description) VALUES ('audit:read', 'Read the audit log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'audit:read')
+ON CONFLICT DO NOTHING;
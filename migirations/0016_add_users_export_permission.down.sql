@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission = 'users:export';
+DELETE FROM permissions WHERE name = 'users:export';
@@ -0,0 +1,6 @@
+-- Permission for the streaming user export
+INSERT INTO permissions (name, description) VALUES ('users:export', 'Export users in bulk')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'users:export')
+ON CONFLICT DO NOTHING;
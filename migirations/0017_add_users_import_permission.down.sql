@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission = 'users:import';
+DELETE FROM permissions WHERE name = 'users:import';
@@ -0,0 +1,6 @@
+-- Permission for the bulk user import
+INSERT INTO permissions (name, description) VALUES ('users:import', 'Import users in bulk')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'users:import')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,8 @@
+// Package migrations embeds the versioned schema migrations applied by internal/migrate.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/MiladJlz/dekamond-task/internal/auth"
+)
+
+// The in-memory store grants the admin role auth.AllPermissions; the migrations must seed the same
+func TestMigrationsSeedAllPermissions(t *testing.T) {
+	ups, err := fs.Glob(FS, "*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sql strings.Builder
+	for _, name := range ups {
+		raw, err := fs.ReadFile(FS, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql.Write(raw)
+	}
+
+	for _, permission := range auth.AllPermissions {
+		if !strings.Contains(sql.String(), "'"+permission+"'") {
+			t.Errorf("no migration adds permission %s", permission)
+		}
+	}
+}